@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+func runBench(c *client, args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	n := fs.Int("n", 1000, "total number of requests")
+	concurrency := fs.Int("c", 10, "number of concurrent workers")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 2 {
+		return fmt.Errorf("usage: bench [-n requests] [-c concurrency] <group> <key>...")
+	}
+	if *n <= 0 || *concurrency <= 0 {
+		return fmt.Errorf("-n and -c must be positive")
+	}
+	group, keys := fs.Arg(0), fs.Args()[1:]
+	// 预先构造哈希环，避免并发初始化
+	if _, err := c.ring(); err != nil {
+		return err
+	}
+
+	var (
+		next      int64 = -1
+		errs      int64
+		mu        sync.Mutex
+		latencies = make([]time.Duration, 0, *n)
+		wg        sync.WaitGroup
+	)
+	start := time.Now()
+	for w := 0; w < *concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := atomic.AddInt64(&next, 1)
+				if i >= int64(*n) {
+					return
+				}
+				begin := time.Now()
+				_, err := c.get(group, keys[int(i)%len(keys)])
+				d := time.Since(begin)
+				if err != nil {
+					atomic.AddInt64(&errs, 1)
+					continue
+				}
+				mu.Lock()
+				latencies = append(latencies, d)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	fmt.Printf("%-13s%d (%d errors)\n", "requests:", *n, errs)
+	fmt.Printf("%-13s%d\n", "concurrency:", *concurrency)
+	fmt.Printf("%-13s%v (%.1f req/s)\n", "elapsed:", elapsed, float64(*n)/elapsed.Seconds())
+	if len(latencies) == 0 {
+		return fmt.Errorf("all requests failed")
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	for _, p := range []float64{50, 90, 99, 99.9} {
+		fmt.Printf("%-13s%v\n", fmt.Sprintf("p%v:", p), percentile(latencies, p))
+	}
+	fmt.Printf("%-13s%v\n", "max:", latencies[len(latencies)-1])
+	return nil
+}
+
+// percentile 返回已排序的延迟中的第p百分位
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	idx := int(float64(len(sorted))*p/100+0.5) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx]
+}
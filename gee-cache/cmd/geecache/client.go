@@ -0,0 +1,193 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"geeCache"
+	"geeCache/consistentHash"
+	pb "geeCache/geecachepb"
+	"google.golang.org/protobuf/proto"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// client 直接按照一致性哈希访问key的owner，不经过任何中间节点
+type client struct {
+	peers    []string
+	admin    string
+	token    string // 管理接口修改操作需要的token
+	basePath string
+	replicas int
+	secret   []byte
+	timeout  time.Duration
+	tls      *tls.Config // 非nil时使用双向TLS访问节点，节点地址应为https://
+
+	http *http.Client
+	hash *consistentHash.Map
+}
+
+// peerList 返回节点列表，未指定 -peers 时从管理接口获取
+func (c *client) peerList() ([]string, error) {
+	if len(c.peers) > 0 {
+		return c.peers, nil
+	}
+	if c.admin == "" {
+		return nil, fmt.Errorf("either -peers or -admin is required")
+	}
+	res, err := c.httpClient().Get(strings.TrimSuffix(c.admin, "/") + "/peers")
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("admin returned: %v", res.Status)
+	}
+	var info struct {
+		Peers []string `json:"peers"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&info); err != nil {
+		return nil, fmt.Errorf("decoding peer list: %v", err)
+	}
+	if len(info.Peers) == 0 {
+		return nil, fmt.Errorf("admin reported no peers")
+	}
+	c.peers = info.Peers
+	return c.peers, nil
+}
+
+// ring 使用与服务端相同的参数构造一致性哈希
+func (c *client) ring() (*consistentHash.Map, error) {
+	if c.hash != nil {
+		return c.hash, nil
+	}
+	peers, err := c.peerList()
+	if err != nil {
+		return nil, err
+	}
+	c.hash = consistentHash.New(c.replicas, nil)
+	c.hash.Add(peers...)
+	return c.hash, nil
+}
+
+func (c *client) httpClient() *http.Client {
+	if c.http == nil {
+		c.http = &http.Client{Timeout: c.timeout}
+		if c.tls != nil {
+			c.http.Transport = &http.Transport{TLSClientConfig: c.tls}
+		}
+	}
+	return c.http
+}
+
+// get 从key的owner获取值
+func (c *client) get(group, key string) ([]byte, error) {
+	ring, err := c.ring()
+	if err != nil {
+		return nil, err
+	}
+	u := fmt.Sprintf(
+		"%v%v%v/%v",
+		ring.Get(key),
+		c.basePath,
+		url.QueryEscape(group),
+		url.QueryEscape(key),
+	)
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(c.secret) > 0 {
+		if err := geeCache.SignRequest(req, c.secret); err != nil {
+			return nil, err
+		}
+	}
+	res, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading response body: %v", err)
+	}
+	out := &pb.Response{}
+	if res.StatusCode != http.StatusOK {
+		// 节点把错误放在Response的error字段中
+		if proto.Unmarshal(body, out) == nil && out.Error != nil {
+			return nil, fmt.Errorf("server returned: %v: %s", res.Status, out.Error.GetMessage())
+		}
+		return nil, fmt.Errorf("server returned: %v: %s", res.Status, strings.TrimSpace(string(body)))
+	}
+	if err := proto.Unmarshal(body, out); err != nil {
+		return nil, fmt.Errorf("decoding response body: %v", err)
+	}
+	return out.GetValue(), nil
+}
+
+// adminPost 向管理接口发送POST请求，配置了token时带上token
+func (c *client) adminPost(u string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return c.httpClient().Do(req)
+}
+
+// invalidate 通过管理接口让所有节点删除key
+func (c *client) invalidate(group, key string, prefix bool) error {
+	if c.admin == "" {
+		return fmt.Errorf("-admin is required")
+	}
+	action := "invalidate"
+	if prefix {
+		action = "invalidate_prefix"
+	}
+	u := fmt.Sprintf(
+		"%v/groups/%v/%v/%v",
+		strings.TrimSuffix(c.admin, "/"),
+		url.PathEscape(group),
+		action,
+		url.PathEscape(key),
+	)
+	res, err := c.adminPost(u)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(res.Body)
+		return fmt.Errorf("admin returned: %v: %s", res.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// resize 通过管理接口修改某个节点上group的内存上限
+func (c *client) resize(group string, cacheBytes int64) error {
+	if c.admin == "" {
+		return fmt.Errorf("-admin is required")
+	}
+	u := fmt.Sprintf(
+		"%v/groups/%v/resize?cache_bytes=%d",
+		strings.TrimSuffix(c.admin, "/"),
+		url.PathEscape(group),
+		cacheBytes,
+	)
+	res, err := c.adminPost(u)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("admin returned: %v: %s", res.Status, strings.TrimSpace(string(body)))
+	}
+	fmt.Println(strings.TrimSpace(string(body)))
+	return nil
+}
@@ -0,0 +1,190 @@
+// Command geecache is a command-line client for a running geecache cluster.
+//
+// Usage:
+//
+//	geecache [flags] get <group> <key>
+//	geecache [flags] peers
+//	geecache [flags] owner <key>
+//	geecache [flags] ring
+//	geecache [flags] invalidate [-prefix] <group> <key>
+//	geecache [flags] resize <group> <bytes>
+//	geecache [flags] bench [-n requests] [-c concurrency] <group> <key>...
+//
+// 节点列表通过 -peers 直接指定，或者通过 -admin 从某个节点的管理接口获取。
+// 节点之间使用双向TLS时，通过 -cert、-key 和 -ca 指定客户端证书
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"geeCache"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `usage: geecache [flags] <command> [args]
+
+commands:
+  get <group> <key>    fetch a value from the key's owner
+  peers                print the peer list
+  owner <key>          print the peer owning key
+  ring                 print the virtual node layout
+  invalidate [-prefix] <group> <key>
+                       drop key (or every key with the prefix) on all peers
+  resize <group> <bytes> change the cache size of the -admin node
+  bench <group> <key>... drive concurrent gets and report latency
+
+flags:
+`)
+	flag.PrintDefaults()
+}
+
+func main() {
+	var (
+		peers    = flag.String("peers", "", "comma separated peer addresses, e.g. http://localhost:8001")
+		admin    = flag.String("admin", "", "admin API of any node to discover peers, e.g. http://localhost:8001/_admin/")
+		basePath = flag.String("base", "/_geecache/", "base path of the peer protocol")
+		replicas = flag.Int("replicas", 50, "virtual nodes per peer, must match the servers")
+		secret   = flag.String("secret", "", "shared secret used to sign requests")
+		token    = flag.String("admin-token", "", "token required by the admin API for invalidate and resize")
+		timeout  = flag.Duration("timeout", 5*time.Second, "request timeout")
+		cert     = flag.String("cert", "", "client certificate for peers using mutual TLS, with -key and -ca")
+		key      = flag.String("key", "", "private key of -cert")
+		ca       = flag.String("ca", "", "CA certificate that signed the peers' certificates")
+	)
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	c := &client{
+		basePath: *basePath,
+		replicas: *replicas,
+		admin:    *admin,
+		token:    *token,
+		timeout:  *timeout,
+	}
+	if *secret != "" {
+		c.secret = []byte(*secret)
+	}
+	tlsConfig, err := newTLSConfig(*cert, *key, *ca)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "geecache:", err)
+		os.Exit(2)
+	}
+	c.tls = tlsConfig
+	if *peers != "" {
+		c.peers = strings.Split(*peers, ",")
+	}
+
+	cmd, args := flag.Arg(0), flag.Args()[1:]
+	switch cmd {
+	case "get":
+		err = runGet(c, args)
+	case "peers":
+		err = runPeers(c, args)
+	case "owner":
+		err = runOwner(c, args)
+	case "ring":
+		err = runRing(c, args)
+	case "bench":
+		err = runBench(c, args)
+	case "invalidate":
+		err = runInvalidate(c, args)
+	case "resize":
+		err = runResize(c, args)
+	default:
+		err = fmt.Errorf("unknown command %q", cmd)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "geecache:", err)
+		os.Exit(1)
+	}
+}
+
+// newTLSConfig 按 -cert、-key 和 -ca 创建双向TLS配置，三者都为空时返回nil
+func newTLSConfig(cert, key, ca string) (*tls.Config, error) {
+	if cert == "" && key == "" && ca == "" {
+		return nil, nil
+	}
+	if cert == "" || key == "" || ca == "" {
+		return nil, fmt.Errorf("-cert, -key and -ca must be set together")
+	}
+	return geeCache.NewMutualTLSConfig(cert, key, ca)
+}
+
+func runGet(c *client, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: get <group> <key>")
+	}
+	value, err := c.get(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	os.Stdout.Write(value)
+	fmt.Println()
+	return nil
+}
+
+func runPeers(c *client, args []string) error {
+	peers, err := c.peerList()
+	if err != nil {
+		return err
+	}
+	for _, peer := range peers {
+		fmt.Println(peer)
+	}
+	return nil
+}
+
+func runOwner(c *client, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: owner <key>")
+	}
+	ring, err := c.ring()
+	if err != nil {
+		return err
+	}
+	fmt.Println(ring.Get(args[0]))
+	return nil
+}
+
+func runRing(c *client, args []string) error {
+	ring, err := c.ring()
+	if err != nil {
+		return err
+	}
+	for _, node := range ring.Ring() {
+		fmt.Printf("%10d  %s\n", node.Hash, node.Node)
+	}
+	return nil
+}
+
+func runInvalidate(c *client, args []string) error {
+	fs := flag.NewFlagSet("invalidate", flag.ContinueOnError)
+	prefix := fs.Bool("prefix", false, "drop every key starting with <key>")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return fmt.Errorf("usage: invalidate [-prefix] <group> <key>")
+	}
+	return c.invalidate(fs.Arg(0), fs.Arg(1), *prefix)
+}
+
+func runResize(c *client, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: resize <group> <bytes>")
+	}
+	cacheBytes, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil || cacheBytes < 0 {
+		return fmt.Errorf("bytes must be a non-negative integer")
+	}
+	return c.resize(args[0], cacheBytes)
+}
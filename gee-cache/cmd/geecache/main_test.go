@@ -0,0 +1,243 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"geeCache"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var db = map[string]string{
+	"Tom":  "630",
+	"Jack": "589",
+	"Sam":  "567",
+}
+
+// newTestNode 启动一个单节点集群，同时提供节点间协议和管理接口，
+// 返回指向它的client
+func newTestNode(t *testing.T, group, token string) (*client, *geeCache.Group) {
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	pool := geeCache.NewHTTPPool(srv.URL)
+	pool.Set(srv.URL)
+	admin := geeCache.NewAdminHandler("/_admin/", pool)
+	admin.Token = token
+	mux.Handle("/_geecache/", pool)
+	mux.Handle("/_admin/", admin)
+
+	g := geeCache.NewGroup(group, geeCache.GetterFunc(
+		func(key string) ([]byte, error) {
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("%s not exist", key)
+		}), 2<<20)
+	g.RegisterPeers(pool)
+	t.Cleanup(func() { g.Close() })
+	return &client{
+		admin:    srv.URL + "/_admin/",
+		basePath: "/_geecache/",
+		replicas: 50,
+		timeout:  time.Second,
+	}, g
+}
+
+func TestUsage(t *testing.T) {
+	c := &client{}
+	tests := []struct {
+		name string
+		run  func(*client, []string) error
+		args []string
+		want string
+	}{
+		{"get", runGet, []string{"scores"}, "usage: get"},
+		{"owner", runOwner, nil, "usage: owner"},
+		{"invalidate", runInvalidate, []string{"scores"}, "usage: invalidate"},
+		{"invalidate flag", runInvalidate, []string{"-nope", "scores", "Tom"}, "not defined"},
+		{"resize", runResize, []string{"scores"}, "usage: resize"},
+		{"resize bytes", runResize, []string{"scores", "1k"}, "non-negative"},
+		{"resize negative", runResize, []string{"scores", "-1"}, "non-negative"},
+		{"bench", runBench, []string{"scores"}, "usage: bench"},
+		{"bench n", runBench, []string{"-n", "0", "scores", "Tom"}, "must be positive"},
+		{"no peers", runPeers, nil, "-peers or -admin"},
+	}
+	for _, tt := range tests {
+		err := tt.run(c, tt.args)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expect error containing %q, got %v", tt.name, tt.want, err)
+		}
+	}
+}
+
+func TestGet(t *testing.T) {
+	c, _ := newTestNode(t, "cli-get", "")
+	peers, err := c.peerList()
+	if err != nil || len(peers) != 1 {
+		t.Fatalf("expect the peer list from the admin API, got %v %v", peers, err)
+	}
+	if v, err := c.get("cli-get", "Tom"); err != nil || string(v) != "630" {
+		t.Fatalf("expect Tom=630, got %s %v", v, err)
+	}
+	if _, err := c.get("cli-get", "unknown"); err == nil || !strings.Contains(err.Error(), "not exist") {
+		t.Fatalf("expect the server's error, got %v", err)
+	}
+}
+
+func TestInvalidate(t *testing.T) {
+	c, g := newTestNode(t, "cli-invalidate", "")
+	for k := range db {
+		g.Get(k)
+	}
+	if err := runInvalidate(c, []string{"cli-invalidate", "Tom"}); err != nil {
+		t.Fatal(err)
+	}
+	if g.Cached("Tom") || !g.Cached("Jack") {
+		t.Fatal("expect only Tom invalidated")
+	}
+	if err := runInvalidate(c, []string{"-prefix", "cli-invalidate", "J"}); err != nil {
+		t.Fatal(err)
+	}
+	if g.Cached("Jack") || !g.Cached("Sam") {
+		t.Fatal("expect only keys with prefix J invalidated")
+	}
+	if err := runInvalidate(c, []string{"nope", "Tom"}); err == nil {
+		t.Fatal("expect an error for an unknown group")
+	}
+}
+
+func TestResize(t *testing.T) {
+	c, g := newTestNode(t, "cli-resize", "")
+	for k := range db {
+		g.Get(k)
+	}
+	if err := runResize(c, []string{"cli-resize", "1"}); err != nil {
+		t.Fatal(err)
+	}
+	if s := g.CacheStats(); s.MaxBytes != 1 || s.Items != 0 {
+		t.Fatalf("expect the cache resized to 1 byte, got %+v", s)
+	}
+	if err := runResize(c, []string{"nope", "1"}); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("expect 404 for an unknown group, got %v", err)
+	}
+}
+
+func TestAdminToken(t *testing.T) {
+	c, g := newTestNode(t, "cli-token", "s3cret")
+	g.Get("Tom")
+	if err := runInvalidate(c, []string{"cli-token", "Tom"}); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Fatalf("expect 401 without a token, got %v", err)
+	}
+	c.token = "s3cret"
+	if err := runInvalidate(c, []string{"cli-token", "Tom"}); err != nil || g.Cached("Tom") {
+		t.Fatalf("expect Tom invalidated with the token, got %v", err)
+	}
+}
+
+// writeCert 生成一个由parent签名的证书，把证书和私钥以PEM格式写入dir，
+// parent为nil时生成自签名的CA
+func writeCert(t *testing.T, dir, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if parent == nil {
+		tmpl.IsCA, tmpl.BasicConstraintsValid = true, true
+		tmpl.KeyUsage = x509.KeyUsageCertSign
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(dir, name+".pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	os.WriteFile(filepath.Join(dir, name+"-key.pem"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey := writeCert(t, dir, "ca", nil, nil)
+	writeCert(t, dir, "node", ca, caKey)
+	writeCert(t, dir, "cli", ca, caKey)
+	file := func(name string) string { return filepath.Join(dir, name) }
+
+	serverTLS, err := geeCache.NewMutualTLSConfig(file("node.pem"), file("node-key.pem"), file("ca.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewUnstartedServer(nil)
+	srv.TLS = serverTLS
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	pool := geeCache.NewHTTPPool(srv.URL)
+	pool.Set(srv.URL)
+	srv.Config.Handler = pool
+	g := geeCache.NewGroup("cli-tls", geeCache.GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(db[key]), nil
+		}), 2<<10)
+	g.RegisterPeers(pool)
+	t.Cleanup(func() { g.Close() })
+
+	if _, err := newTLSConfig(file("cli.pem"), "", ""); err == nil {
+		t.Fatal("expect -cert without -key and -ca rejected")
+	}
+	clientTLS, err := newTLSConfig(file("cli.pem"), file("cli-key.pem"), file("ca.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &client{peers: []string{srv.URL}, basePath: "/_geecache/", replicas: 50, timeout: time.Second, tls: clientTLS}
+	if v, err := c.get("cli-tls", "Tom"); err != nil || string(v) != "630" {
+		t.Fatalf("expect Tom=630 over mutual TLS, got %s %v", v, err)
+	}
+	// 没有客户端证书时无法访问节点
+	c = &client{peers: []string{srv.URL}, basePath: "/_geecache/", replicas: 50, timeout: time.Second}
+	if _, err := c.get("cli-tls", "Tom"); err == nil {
+		t.Fatal("expect a client without a certificate rejected")
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := make([]time.Duration, 100)
+	for i := range sorted {
+		sorted[i] = time.Duration(i + 1)
+	}
+	for _, tt := range []struct {
+		p    float64
+		want time.Duration
+	}{{50, 50}, {99, 99}, {99.9, 100}, {0, 1}, {100, 100}} {
+		if got := percentile(sorted, tt.p); got != tt.want {
+			t.Errorf("p%v: expect %v, got %v", tt.p, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"geeCache"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Config 描述一个缓存节点的全部配置，可以来自配置文件，也可以被命令行参数覆盖
+type Config struct {
+	Self        string     `json:"self"`         // 本节点在节点列表中的地址, e.g. http://10.0.0.1:8001
+	Listen      string     `json:"listen"`       // 缓存服务监听地址，默认取 self 的 host:port
+	APIListen   string     `json:"api_listen"`   // 对外API服务监听地址，为空则不启动
+	AdminPath   string     `json:"admin_path"`   // 管理接口的路径前缀，为空则不启用
+	AdminToken  string     `json:"admin_token"`  // 管理接口修改操作需要的token，为空时管理接口只应暴露在内网
+	BasePath    string     `json:"base_path"`    // 节点间通讯地址的前缀
+	Replicas    int        `json:"replicas"`     // 每个节点的虚拟节点数
+	Replication int        `json:"replication"`  // 每个key的副本数
+	Secret      string     `json:"secret"`       // 节点间请求签名使用的共享密钥
+	MemoryBytes int64      `json:"memory_bytes"` // 所有group共享的内存预算，0表示不限制
+	LogLevel    string     `json:"log_level"`    // debug, info, warn 或 error，默认warn
+	TLS         *TLSConfig `json:"tls"`
+
+	ShutdownTimeout   Duration `json:"shutdown_timeout"`    // 优雅退出的最长等待时间，默认30s
+	HandoffOnShutdown bool     `json:"handoff_on_shutdown"` // 退出前把数据交给接管的节点
+
+	Peers  []string      `json:"peers"`
+	Groups []GroupConfig `json:"groups"`
+}
+
+// Duration 在JSON中写作 "30s" 这样的字符串
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"30s\"")
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+	return nil
+}
+
+// TLSConfig 节点间双向TLS使用的证书
+type TLSConfig struct {
+	Cert string `json:"cert"`
+	Key  string `json:"key"`
+	CA   string `json:"ca"`
+}
+
+type GroupConfig struct {
+	Name       string `json:"name"`
+	CacheBytes int64  `json:"cache_bytes"` // 配置了 memory_bytes 时可以为0，表示只受共享预算限制
+	MaxEntries int    `json:"max_entries"` // 最多缓存的条目数，0表示只按字节数限制，arena_* 不支持
+	Eviction   string `json:"eviction"`    // 淘汰策略，lru(默认)、clock、arena_fifo 或 arena_lru
+	Priority   int    `json:"priority"`    // 共享预算淘汰数据时的权重
+
+	MaxConcurrentLoads int      `json:"max_concurrent_loads"` // 同时调用loader的上限，0表示不限制
+	MaxLoadQueue       int      `json:"max_load_queue"`       // 达到上限后最多排队的加载数
+	LoadQueueTimeout   Duration `json:"load_queue_timeout"`   // 排队的最长时间
+	HedgeDelay         Duration `json:"hedge_delay"`          // owner超过该时间未响应时发起对冲请求
+	WriteMode          string   `json:"write_mode"`           // 为空时只读，through 或 behind 时通过loader写入
+	HotKeyThreshold    int      `json:"hot_key_threshold"`    // 最近的访问次数达到该值的key视为热点
+	HotCacheTTL        Duration `json:"hot_cache_ttl"`        // 远程热点key在本地缓存的时间，0表示不缓存
+	WarmFile           string   `json:"warm_file"`            // 启动时预热的key列表，每行一个
+	WarmConcurrency    int      `json:"warm_concurrency"`     // 预热时同时加载的key数
+	WarmRate           int      `json:"warm_rate"`            // 预热时每秒最多加载的key数，0表示不限制
+
+	Loader LoaderConfig `json:"loader"`
+}
+
+// LoaderConfig 描述缓存未命中时如何获取源数据
+type LoaderConfig struct {
+	Type string            `json:"type"` // static, file 或 http
+	Data map[string]string `json:"data"` // static: 内置的数据
+	Path string            `json:"path"` // file: JSON对象文件的路径
+	URL  string            `json:"url"`  // http: 包含 {key} 占位符的地址
+}
+
+// loadConfig 读取JSON格式的配置文件
+func loadConfig(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	cfg := &Config{}
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// validate 检查配置并补全默认值，返回的错误中包含所有发现的问题
+func (c *Config) validate() error {
+	var errs []string
+	fail := func(format string, v ...interface{}) {
+		errs = append(errs, fmt.Sprintf(format, v...))
+	}
+
+	if c.BasePath == "" {
+		c.BasePath = "/_geecache/"
+	}
+	if !strings.HasPrefix(c.BasePath, "/") || !strings.HasSuffix(c.BasePath, "/") {
+		fail("base_path %q must start and end with /", c.BasePath)
+	}
+	if c.AdminPath != "" && (!strings.HasPrefix(c.AdminPath, "/") || strings.HasPrefix(c.AdminPath, c.BasePath)) {
+		fail("admin_path %q must start with / and not be under base_path", c.AdminPath)
+	}
+	if c.ShutdownTimeout.Duration == 0 {
+		c.ShutdownTimeout.Duration = 30 * time.Second
+	}
+	if c.ShutdownTimeout.Duration < 0 {
+		fail("shutdown_timeout must be positive")
+	}
+	if c.LogLevel == "" {
+		c.LogLevel = "warn"
+	}
+	if _, err := c.level(); err != nil {
+		fail("log_level: %v", err)
+	}
+	if c.MemoryBytes < 0 {
+		fail("memory_bytes must not be negative")
+	}
+	if c.Replicas < 0 || c.Replication < 0 {
+		fail("replicas and replication must not be negative")
+	}
+
+	self, err := parsePeer(c.Self)
+	switch {
+	case c.Self == "":
+		fail("self is required, e.g. http://localhost:8001")
+	case err != nil:
+		fail("self: %v", err)
+	case c.Listen == "":
+		c.Listen = self.Host
+	}
+
+	seen := make(map[string]bool, len(c.Peers))
+	for i, peer := range c.Peers {
+		if _, err := parsePeer(peer); err != nil {
+			fail("peers[%d]: %v", i, err)
+		}
+		if seen[peer] {
+			fail("peers[%d]: duplicate peer %s", i, peer)
+		}
+		seen[peer] = true
+	}
+	if len(c.Peers) > 0 && c.Self != "" && !seen[c.Self] {
+		fail("self %s is not in peers %v", c.Self, c.Peers)
+	}
+	if c.Replication > len(c.Peers) && len(c.Peers) > 0 {
+		fail("replication %d is larger than the number of peers (%d)", c.Replication, len(c.Peers))
+	}
+
+	if c.TLS != nil && (c.TLS.Cert == "" || c.TLS.Key == "" || c.TLS.CA == "") {
+		fail("tls: cert, key and ca are all required")
+	}
+
+	if len(c.Groups) == 0 {
+		fail("at least one group is required")
+	}
+	names := make(map[string]bool, len(c.Groups))
+	for i := range c.Groups {
+		g := &c.Groups[i]
+		switch {
+		case g.Name == "":
+			fail("groups[%d]: name is required", i)
+		case strings.HasPrefix(g.Name, "_"):
+			fail("groups[%d]: name %q must not start with _", i, g.Name)
+		case names[g.Name]:
+			fail("groups[%d]: duplicate group %q", i, g.Name)
+		}
+		names[g.Name] = true
+		if g.CacheBytes < 0 || (g.CacheBytes == 0 && c.MemoryBytes == 0) {
+			fail("groups[%d] (%s): cache_bytes must be positive", i, g.Name)
+		}
+		if g.MaxEntries < 0 {
+			fail("groups[%d] (%s): max_entries must not be negative", i, g.Name)
+		}
+		if e, err := g.eviction(); err != nil {
+			fail("groups[%d] (%s): %v", i, g.Name, err)
+		} else if g.MaxEntries > 0 && (e == geeCache.EvictArenaFIFO || e == geeCache.EvictArenaLRU) {
+			fail("groups[%d] (%s): max_entries is not supported with eviction %s", i, g.Name, g.Eviction)
+		}
+		if g.Priority < 0 {
+			fail("groups[%d] (%s): priority must not be negative", i, g.Name)
+		}
+		if g.MaxConcurrentLoads < 0 || g.MaxLoadQueue < 0 || g.LoadQueueTimeout.Duration < 0 {
+			fail("groups[%d] (%s): load limits must not be negative", i, g.Name)
+		}
+		if g.HedgeDelay.Duration < 0 {
+			fail("groups[%d] (%s): hedge_delay must not be negative", i, g.Name)
+		}
+		if g.HotKeyThreshold < 0 || g.HotCacheTTL.Duration < 0 {
+			fail("groups[%d] (%s): hot_key_threshold and hot_cache_ttl must not be negative", i, g.Name)
+		}
+		if g.WarmConcurrency < 0 || g.WarmRate < 0 {
+			fail("groups[%d] (%s): warm_concurrency and warm_rate must not be negative", i, g.Name)
+		}
+		if g.WriteMode != "" && g.WriteMode != "through" && g.WriteMode != "behind" {
+			fail("groups[%d] (%s): unknown write_mode %q (want through or behind)", i, g.Name, g.WriteMode)
+		}
+		// 其他节点只接受签名过的写入
+		if g.WriteMode != "" && len(c.Peers) > 1 && c.Secret == "" {
+			fail("groups[%d] (%s): write_mode with several peers requires secret", i, g.Name)
+		}
+		if err := g.Loader.validate(); err != nil {
+			fail("groups[%d] (%s): loader: %v", i, g.Name, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config:\n  %s", strings.Join(errs, "\n  "))
+	}
+	return nil
+}
+
+// level 解析日志级别
+func (c *Config) level() (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(c.LogLevel))
+	return level, err
+}
+
+// eviction 解析淘汰策略
+func (g *GroupConfig) eviction() (geeCache.Eviction, error) {
+	switch g.Eviction {
+	case "", "lru":
+		return geeCache.EvictLRU, nil
+	case "clock":
+		return geeCache.EvictClock, nil
+	case "arena_fifo":
+		return geeCache.EvictArenaFIFO, nil
+	case "arena_lru":
+		return geeCache.EvictArenaLRU, nil
+	}
+	return 0, fmt.Errorf("unknown eviction %q (want lru, clock, arena_fifo or arena_lru)", g.Eviction)
+}
+
+func (l *LoaderConfig) validate() error {
+	switch l.Type {
+	case "static":
+		if len(l.Data) == 0 {
+			return fmt.Errorf("static loader needs data")
+		}
+	case "file":
+		if l.Path == "" {
+			return fmt.Errorf("file loader needs path")
+		}
+	case "http":
+		if !strings.Contains(l.URL, "{key}") {
+			return fmt.Errorf("http loader needs a url containing {key}")
+		}
+		if _, err := url.Parse(strings.Replace(l.URL, "{key}", "k", -1)); err != nil {
+			return err
+		}
+	case "":
+		return fmt.Errorf("type is required (static, file or http)")
+	default:
+		return fmt.Errorf("unknown type %q (want static, file or http)", l.Type)
+	}
+	return nil
+}
+
+// parsePeer 检查节点地址是否为 http(s)://host:port 的形式
+func parsePeer(addr string) (*url.URL, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("%q must start with http:// or https://", addr)
+	}
+	if u.Host == "" || (u.Path != "" && u.Path != "/") {
+		return nil, fmt.Errorf("%q must be of the form scheme://host:port", addr)
+	}
+	return u, nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"geeCache"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// validConfig 返回一份能通过校验的最小配置
+func validConfig() *Config {
+	return &Config{
+		Self:  "http://localhost:8001",
+		Peers: []string{"http://localhost:8001", "http://localhost:8002"},
+		Groups: []GroupConfig{{
+			Name:       "scores",
+			CacheBytes: 2 << 10,
+			Loader:     LoaderConfig{Type: "static", Data: map[string]string{"Tom": "630"}},
+		}},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+		want   string // 为空表示应当通过校验
+	}{
+		{"valid", func(c *Config) {}, ""},
+		{"single node", func(c *Config) { c.Peers = nil }, ""},
+		{"no self", func(c *Config) { c.Self = "" }, "self is required"},
+		{"self scheme", func(c *Config) { c.Self = "localhost:8001" }, "must start with http://"},
+		{"self path", func(c *Config) { c.Self = "http://localhost:8001/x" }, "scheme://host:port"},
+		{"self not in peers", func(c *Config) { c.Self = "http://localhost:8003" }, "is not in peers"},
+		{"duplicate peer", func(c *Config) { c.Peers = append(c.Peers, c.Peers[1]) }, "duplicate peer"},
+		{"replication", func(c *Config) { c.Replication = 3 }, "larger than the number of peers"},
+		{"negative replicas", func(c *Config) { c.Replicas = -1 }, "must not be negative"},
+		{"base path", func(c *Config) { c.BasePath = "/_geecache" }, "must start and end with /"},
+		{"admin under base", func(c *Config) { c.AdminPath = "/_geecache/admin/" }, "not be under base_path"},
+		{"log level", func(c *Config) { c.LogLevel = "loud" }, "log_level"},
+		{"shutdown timeout", func(c *Config) { c.ShutdownTimeout.Duration = -time.Second }, "shutdown_timeout"},
+		{"tls", func(c *Config) { c.TLS = &TLSConfig{Cert: "cert.pem"} }, "cert, key and ca"},
+		{"no groups", func(c *Config) { c.Groups = nil }, "at least one group"},
+		{"group name", func(c *Config) { c.Groups[0].Name = "_internal" }, "must not start with _"},
+		{"duplicate group", func(c *Config) { c.Groups = append(c.Groups, c.Groups[0]) }, "duplicate group"},
+		{"cache bytes", func(c *Config) { c.Groups[0].CacheBytes = 0 }, "cache_bytes must be positive"},
+		{"shared budget", func(c *Config) { c.Groups[0].CacheBytes, c.MemoryBytes = 0, 1<<20 }, ""},
+		{"max entries", func(c *Config) { c.Groups[0].MaxEntries = -1 }, "max_entries"},
+		{"eviction", func(c *Config) { c.Groups[0].Eviction = "random" }, "unknown eviction"},
+		{"arena max entries", func(c *Config) { c.Groups[0].Eviction, c.Groups[0].MaxEntries = "arena_lru", 10 }, "not supported"},
+		{"clock max entries", func(c *Config) { c.Groups[0].Eviction, c.Groups[0].MaxEntries = "clock", 10 }, ""},
+		{"write mode", func(c *Config) { c.Groups[0].WriteMode = "around" }, "unknown write_mode"},
+		{"write without secret", func(c *Config) { c.Groups[0].WriteMode = "through" }, "requires secret"},
+		{"write with secret", func(c *Config) { c.Groups[0].WriteMode, c.Secret = "through", "s" }, ""},
+		{"single node write", func(c *Config) { c.Groups[0].WriteMode, c.Peers = "through", nil }, ""},
+		{"hedge delay", func(c *Config) { c.Groups[0].HedgeDelay.Duration = -1 }, "hedge_delay"},
+		{"hot cache ttl", func(c *Config) { c.Groups[0].HotCacheTTL.Duration = -1 }, "hot_cache_ttl"},
+		{"warm rate", func(c *Config) { c.Groups[0].WarmRate = -1 }, "warm_rate"},
+		{"loader type", func(c *Config) { c.Groups[0].Loader = LoaderConfig{} }, "type is required"},
+		{"http loader", func(c *Config) {
+			c.Groups[0].Loader = LoaderConfig{Type: "http", URL: "http://db/keys"}
+		}, "containing {key}"},
+	}
+	for _, tt := range tests {
+		c := validConfig()
+		tt.modify(c)
+		err := c.validate()
+		switch {
+		case tt.want == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+			t.Errorf("%s: expect error containing %q, got %v", tt.name, tt.want, err)
+		}
+	}
+}
+
+func TestValidateDefaults(t *testing.T) {
+	c := validConfig()
+	if err := c.validate(); err != nil {
+		t.Fatal(err)
+	}
+	if c.BasePath != "/_geecache/" || c.Listen != "localhost:8001" || c.LogLevel != "warn" ||
+		c.ShutdownTimeout.Duration != 30*time.Second {
+		t.Fatalf("unexpected defaults %+v", c)
+	}
+}
+
+func TestValidateReportsAllErrors(t *testing.T) {
+	c := validConfig()
+	c.Self = ""
+	c.Groups[0].Eviction = "random"
+	err := c.validate()
+	if err == nil || !strings.Contains(err.Error(), "self is required") || !strings.Contains(err.Error(), "unknown eviction") {
+		t.Fatalf("expect both problems reported, got %v", err)
+	}
+}
+
+func TestEviction(t *testing.T) {
+	tests := []struct {
+		eviction string
+		want     geeCache.Eviction
+		ok       bool
+	}{
+		{"", geeCache.EvictLRU, true},
+		{"lru", geeCache.EvictLRU, true},
+		{"clock", geeCache.EvictClock, true},
+		{"arena_fifo", geeCache.EvictArenaFIFO, true},
+		{"arena_lru", geeCache.EvictArenaLRU, true},
+		{"LRU", 0, false},
+		{"arena", 0, false},
+	}
+	for _, tt := range tests {
+		g := &GroupConfig{Eviction: tt.eviction}
+		got, err := g.eviction()
+		if (err == nil) != tt.ok || (tt.ok && got != tt.want) {
+			t.Errorf("eviction %q: expect %v (ok=%v), got %v %v", tt.eviction, tt.want, tt.ok, got, err)
+		}
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	os.WriteFile(path, []byte(`{"self": "http://localhost:8001", "shutdown_timeout": "5s"}`), 0o644)
+	c, err := loadConfig(path)
+	if err != nil || c.Self != "http://localhost:8001" || c.ShutdownTimeout.Duration != 5*time.Second {
+		t.Fatalf("unexpected config %+v %v", c, err)
+	}
+
+	os.WriteFile(path, []byte(`{"slef": "http://localhost:8001"}`), 0o644)
+	if _, err := loadConfig(path); err == nil || !strings.Contains(err.Error(), "slef") {
+		t.Fatalf("expect unknown fields rejected, got %v", err)
+	}
+	os.WriteFile(path, []byte(`{"shutdown_timeout": 5}`), 0o644)
+	if _, err := loadConfig(path); err == nil {
+		t.Fatal("expect a numeric duration rejected")
+	}
+}
+
+// 仓库中的示例配置加上 self 和 secret 之后应当能通过校验，
+// 示例中不带密钥，以免被原样用在生产环境中
+func TestExampleConfig(t *testing.T) {
+	c, err := loadConfig("geecache.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Secret != "" {
+		t.Fatal("the example config must not ship a secret")
+	}
+	c.Self = c.Peers[0]
+	c.Secret = "test-secret"
+	if err := c.validate(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,10 +1,13 @@
 #!/bin/bash
 trap "rm server;kill 0" EXIT
 
+# 每次启动生成一个新的密钥，示例配置中不带密钥
+SECRET=$(head -c 16 /dev/urandom | od -An -tx1 | tr -d ' \n')
+
 go build -o server
-./server -port=8001 &
-./server -port=8002 &
-./server -port=8003 -api=1 &
+./server -config=geecache.json -secret=$SECRET -log-level=debug -self=http://localhost:8001 &
+./server -config=geecache.json -secret=$SECRET -log-level=debug -self=http://localhost:8002 &
+./server -config=geecache.json -secret=$SECRET -log-level=debug -self=http://localhost:8003 -api=localhost:9999 &
 
 sleep 2
 echo ">>> start test"
@@ -12,4 +15,4 @@ curl "http://localhost:9999/api?key=Tom" &
 curl "http://localhost:9999/api?key=Tom" &
 curl "http://localhost:9999/api?key=Tom" &
 
-wait
\ No newline at end of file
+wait
@@ -0,0 +1,272 @@
+package geeCache
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"geeCache/consistentHash"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// AdminHandler serves a JSON API for inspecting and managing the groups
+// of this process and the ring of its HTTPPool.
+//
+//	GET    <prefix>groups                          列出所有group
+//	GET    <prefix>groups/<group>                  单个group的统计信息
+//	DELETE <prefix>groups/<group>                  清空group的本地缓存
+//	GET    <prefix>groups/<group>/keys/<key>       获取key的值
+//	DELETE <prefix>groups/<group>/keys/<key>       从本地缓存中删除key
+//	GET    <prefix>groups/<group>/owner/<key>      key的owner以及是否缓存在本地
+//	GET    <prefix>groups/<group>/hot              访问最频繁的key
+//	POST   <prefix>groups/<group>/resize?cache_bytes=<n> 修改本地缓存的内存上限
+//	POST   <prefix>groups/<group>/invalidate/<key> 从所有节点删除key
+//	POST   <prefix>groups/<group>/invalidate_prefix/<prefix> 从所有节点删除以prefix开头的key
+//	GET    <prefix>peers                           节点列表
+//	GET    <prefix>ring                            一致性哈希环上的虚拟节点
+//
+// The DELETE and POST routes change the cache of this or every node. Set
+// Token to require it on those routes, or serve the handler only on a
+// private listener.
+type AdminHandler struct {
+	prefix string
+	pool   *HTTPPool
+
+	// Token, if set, must be sent as "Authorization: Bearer <Token>" on
+	// every request that is not a GET.
+	Token string
+}
+
+// NewAdminHandler returns an admin handler mounted under prefix, e.g. "/_admin/".
+func NewAdminHandler(prefix string, pool *HTTPPool) *AdminHandler {
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return &AdminHandler{prefix: prefix, pool: pool}
+}
+
+type groupInfo struct {
+	Name  string     `json:"name"`
+	Cache CacheStats `json:"cache"`
+	Stats Stats      `json:"stats"`
+}
+
+type keyInfo struct {
+	Group   string   `json:"group"`
+	Key     string   `json:"key"`
+	Value   []byte   `json:"value,omitempty"`
+	Owners  []string `json:"owners,omitempty"`
+	IsOwner bool     `json:"is_owner"`
+	Cached  bool     `json:"cached"`
+	Evicted bool     `json:"evicted,omitempty"`
+
+	Invalidated bool `json:"invalidated,omitempty"`
+}
+
+type resizeInfo struct {
+	Evicted int        `json:"evicted"`
+	Cache   CacheStats `json:"cache"`
+}
+
+type peersInfo struct {
+	Self        string                  `json:"self"`
+	Peers       []string                `json:"peers"`
+	Replication int                     `json:"replication"`
+	RingVersion string                  `json:"ring_version"`
+	Breakers    map[string]BreakerState `json:"breakers"`
+}
+
+type ringInfo struct {
+	Replicas int                          `json:"replicas"`
+	Nodes    []consistentHash.VirtualNode `json:"nodes"`
+}
+
+func newGroupInfo(g *Group) groupInfo {
+	return groupInfo{Name: g.name, Cache: g.CacheStats(), Stats: g.Stats.Snapshot()}
+}
+
+func (a *AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, a.prefix) {
+		http.NotFound(w, r)
+		return
+	}
+	// 只读的请求不需要token
+	if r.Method != http.MethodGet && !a.authorized(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, "missing or bad admin token")
+		return
+	}
+	// 约定访问路径格式为 <prefix>groups/<group>/<action>/<key>
+	parts := strings.SplitN(r.URL.Path[len(a.prefix):], "/", 4)
+	switch {
+	case parts[0] == "peers" && len(parts) == 1:
+		a.get(w, r, a.peers)
+	case parts[0] == "ring" && len(parts) == 1:
+		a.get(w, r, a.ring)
+	case parts[0] == "groups" && (len(parts) == 1 || parts[1] == ""):
+		a.get(w, r, a.groups)
+	case parts[0] == "groups" && len(parts) == 2:
+		a.serveGroup(w, r, parts[1])
+	case parts[0] == "groups" && len(parts) == 3 && parts[2] == "hot":
+		a.serveHotKeys(w, r, parts[1])
+	case parts[0] == "groups" && len(parts) == 3 && parts[2] == "resize":
+		a.serveResize(w, r, parts[1])
+	case parts[0] == "groups" && len(parts) == 4 && parts[3] != "":
+		a.serveKey(w, r, parts[1], parts[2], parts[3])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// authorized 判断请求是否携带了正确的token，没有配置token时总是通过
+func (a *AdminHandler) authorized(r *http.Request) bool {
+	if a.Token == "" {
+		return true
+	}
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(auth[len("Bearer "):]), []byte(a.Token)) == 1
+}
+
+func (a *AdminHandler) get(w http.ResponseWriter, r *http.Request, fn func() interface{}) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, fn())
+}
+
+func (a *AdminHandler) groups() interface{} {
+	gs := allGroups()
+	sort.Slice(gs, func(i, j int) bool { return gs[i].name < gs[j].name })
+	infos := make([]groupInfo, len(gs))
+	for i, g := range gs {
+		infos[i] = newGroupInfo(g)
+	}
+	return infos
+}
+
+func (a *AdminHandler) peers() interface{} {
+	return peersInfo{
+		Self:        a.pool.Self(),
+		Peers:       a.pool.Peers(),
+		Replication: a.pool.opts.Replication,
+		RingVersion: a.pool.RingVersion(),
+		Breakers:    a.pool.BreakerStates(),
+	}
+}
+
+func (a *AdminHandler) ring() interface{} {
+	return ringInfo{Replicas: a.pool.opts.Replicas, Nodes: a.pool.Ring()}
+}
+
+func (a *AdminHandler) serveGroup(w http.ResponseWriter, r *http.Request, name string) {
+	group := GetGroup(name)
+	if group == nil {
+		writeError(w, http.StatusNotFound, "no such group: "+name)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, newGroupInfo(group))
+	case http.MethodDelete:
+		writeJSON(w, http.StatusOK, map[string]int{"purged": group.Purge()})
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (a *AdminHandler) serveHotKeys(w http.ResponseWriter, r *http.Request, name string) {
+	group := GetGroup(name)
+	if group == nil {
+		writeError(w, http.StatusNotFound, "no such group: "+name)
+		return
+	}
+	a.get(w, r, func() interface{} { return group.HotKeys() })
+}
+
+// serveResize 在运行时修改group的内存上限，例如内存紧张时缩小缓存
+func (a *AdminHandler) serveResize(w http.ResponseWriter, r *http.Request, name string) {
+	group := GetGroup(name)
+	if group == nil {
+		writeError(w, http.StatusNotFound, "no such group: "+name)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	cacheBytes, err := strconv.ParseInt(r.URL.Query().Get("cache_bytes"), 10, 64)
+	if err != nil || cacheBytes < 0 {
+		writeError(w, http.StatusBadRequest, "cache_bytes must be a non-negative integer")
+		return
+	}
+	evicted := group.Resize(cacheBytes)
+	writeJSON(w, http.StatusOK, resizeInfo{Evicted: evicted, Cache: group.CacheStats()})
+}
+
+func (a *AdminHandler) serveKey(w http.ResponseWriter, r *http.Request, name, action, key string) {
+	group := GetGroup(name)
+	if group == nil {
+		writeError(w, http.StatusNotFound, "no such group: "+name)
+		return
+	}
+	info := keyInfo{Group: name, Key: key, Owners: a.pool.Owners(key)}
+	for _, owner := range info.Owners {
+		if owner == a.pool.Self() {
+			info.IsOwner = true
+		}
+	}
+
+	switch {
+	case action == "owner" && r.Method == http.MethodGet:
+		info.Cached = group.Cached(key)
+	case action == "keys" && r.Method == http.MethodGet:
+		info.Cached = group.Cached(key)
+		view, err := group.Get(key)
+		if errors.Is(err, ErrNotFound) {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		info.Value = view.bytes()
+	case action == "keys" && r.Method == http.MethodDelete:
+		info.Evicted = group.Evict(key)
+	case (action == "invalidate" || action == "invalidate_prefix") && r.Method == http.MethodPost:
+		var err error
+		if action == "invalidate" {
+			err = a.pool.Invalidate(r.Context(), name, key)
+		} else {
+			err = a.pool.InvalidatePrefix(r.Context(), name, key)
+		}
+		if err != nil {
+			writeError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+		info.Invalidated = true
+	case action == "keys" || action == "owner" || action == "invalidate" || action == "invalidate_prefix":
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"error": msg})
+}
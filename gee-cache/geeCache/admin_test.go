@@ -0,0 +1,138 @@
+package geeCache
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func adminDo(t *testing.T, method, url string, out interface{}) int {
+	req, _ := http.NewRequest(method, url, nil)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if out != nil && res.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return res.StatusCode
+}
+
+func TestAdminHandler(t *testing.T) {
+	gee := NewGroup("admin", GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(db[key]), nil
+		}), 2<<10)
+	pool := NewHTTPPool("http://self")
+	pool.Set("http://self", "http://other")
+	srv := httptest.NewServer(NewAdminHandler("/_admin", pool))
+	defer srv.Close()
+
+	var key keyInfo
+	if code := adminDo(t, http.MethodGet, srv.URL+"/_admin/groups/admin/keys/Tom", &key); code != http.StatusOK {
+		t.Fatalf("fetch key: expect 200, got %d", code)
+	}
+	if string(key.Value) != "630" || len(key.Owners) != 1 {
+		t.Fatalf("unexpected key info %+v", key)
+	}
+
+	key = keyInfo{}
+	adminDo(t, http.MethodGet, srv.URL+"/_admin/groups/admin/owner/Tom", &key)
+	if !key.Cached || key.Owners[0] != pool.Owners("Tom")[0] {
+		t.Fatalf("expect Tom cached locally, got %+v", key)
+	}
+
+	var info groupInfo
+	adminDo(t, http.MethodGet, srv.URL+"/_admin/groups/admin", &info)
+	if info.Name != "admin" || info.Cache.Items != 1 {
+		t.Fatalf("unexpected group info %+v", info)
+	}
+
+	key = keyInfo{}
+	adminDo(t, http.MethodDelete, srv.URL+"/_admin/groups/admin/keys/Tom", &key)
+	if !key.Evicted || gee.Cached("Tom") {
+		t.Fatal("expect Tom evicted")
+	}
+
+	gee.Get("Jack")
+	var purged map[string]int
+	adminDo(t, http.MethodDelete, srv.URL+"/_admin/groups/admin", &purged)
+	if purged["purged"] != 1 || gee.CacheStats().Items != 0 {
+		t.Fatalf("expect 1 purged, got %v", purged)
+	}
+
+	for k := range db {
+		gee.Get(k)
+	}
+	var resized resizeInfo
+	adminDo(t, http.MethodPost, srv.URL+"/_admin/groups/admin/resize?cache_bytes=1", &resized)
+	if resized.Evicted != 3 || resized.Cache.Items != 0 || resized.Cache.MaxBytes != 1 {
+		t.Fatalf("expect all 3 keys evicted, got %+v", resized)
+	}
+	if code := adminDo(t, http.MethodPost, srv.URL+"/_admin/groups/admin/resize?cache_bytes=-1", nil); code != http.StatusBadRequest {
+		t.Fatalf("negative size: expect 400, got %d", code)
+	}
+
+	var peers peersInfo
+	adminDo(t, http.MethodGet, srv.URL+"/_admin/peers", &peers)
+	if peers.Self != "http://self" || len(peers.Peers) != 2 {
+		t.Fatalf("unexpected peers %+v", peers)
+	}
+	var ring ringInfo
+	adminDo(t, http.MethodGet, srv.URL+"/_admin/ring", &ring)
+	if len(ring.Nodes) != 2*defaultReplicas {
+		t.Fatalf("expect %d virtual nodes, got %d", 2*defaultReplicas, len(ring.Nodes))
+	}
+
+	if code := adminDo(t, http.MethodGet, srv.URL+"/_admin/groups/nope", nil); code != http.StatusNotFound {
+		t.Fatalf("unknown group: expect 404, got %d", code)
+	}
+}
+
+func TestAdminToken(t *testing.T) {
+	gee := NewGroup("admin-token", GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(db[key]), nil
+		}), 2<<10)
+	pool := NewHTTPPool("http://self")
+	pool.Set("http://self")
+	admin := NewAdminHandler("/_admin", pool)
+	admin.Token = "s3cret"
+	srv := httptest.NewServer(admin)
+	defer srv.Close()
+
+	gee.Get("Tom")
+	u := srv.URL + "/_admin/groups/admin-token/keys/Tom"
+	// 只读的请求不需要token
+	if code := adminDo(t, http.MethodGet, u, nil); code != http.StatusOK {
+		t.Fatalf("get without token: expect 200, got %d", code)
+	}
+	for _, auth := range []string{"", "Bearer wrong", "s3cret"} {
+		req, _ := http.NewRequest(http.MethodDelete, u, nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusUnauthorized || !gee.Cached("Tom") {
+			t.Fatalf("Authorization %q: expect 401, got %d", auth, res.StatusCode)
+		}
+	}
+	req, _ := http.NewRequest(http.MethodDelete, u, nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || gee.Cached("Tom") {
+		t.Fatalf("with token: expect Tom evicted, got %d", res.StatusCode)
+	}
+}
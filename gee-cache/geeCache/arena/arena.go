@@ -0,0 +1,352 @@
+// Package arena implements a cache that keeps keys and values in large
+// byte segments instead of one heap object per entry. The index maps the
+// hash of a key to the position of its record and contains no pointers,
+// so the garbage collector does not scan the entries at all, however
+// many there are.
+//
+// Segments are filled in order and evicted whole, oldest first. With the
+// LRU policy, records read since they were written get a second chance
+// and are copied to the newest segment instead of being evicted, which
+// approximates LRU.
+package arena
+
+import (
+	"encoding/binary"
+	"geeCache/lru"
+)
+
+// Policy selects how records are evicted.
+type Policy int
+
+const (
+	// FIFO evicts records in the order they were added.
+	FIFO Policy = iota
+	// LRU moves records that were read since they were added to the newest
+	// segment when their segment is evicted.
+	LRU
+)
+
+const (
+	// 记录头: hash(8) keyLen(4) valueLen(4) flags(1)，后面依次是key和value
+	headerSize = 17
+
+	flagAccessed = 1 << 0
+	flagDeleted  = 1 << 1
+
+	minSegmentSize = 4 << 10
+	maxSegmentSize = 4 << 20
+)
+
+// 索引 map[uint64]uint64 每个条目的估计开销
+var indexEntrySize = lru.MapEntrySize(16)
+
+// Cache 是基于字节分段的缓存，并发不安全，Get也会修改访问标记
+type Cache struct {
+	policy  Policy
+	segSize int
+	// 允许使用的最大内存，为0表示不限制
+	maxBytes int64
+	// 从旧到新的分段，segs[i] 的编号为 firstID+i
+	segs    [][]byte
+	firstID uint32
+	// 最近一次淘汰的分段，新分段优先复用它的内存
+	spare []byte
+	// key的hash -> 分段编号<<32 | 段内偏移
+	index map[uint64]uint64
+	// 记录被移除时的回调函数，可以为nil；value 只在回调期间有效
+	OnEvicted func(key string, value []byte)
+}
+
+// NewCache creates a cache using at most maxBytes, 0 meaning no limit.
+// The memory is allocated in segments of about maxBytes/16 bytes; values
+// that do not fit in a segment are not cached.
+func NewCache(maxBytes int64, policy Policy, onEvicted func(key string, value []byte)) *Cache {
+	return &Cache{
+		policy:    policy,
+		segSize:   segmentSize(maxBytes),
+		maxBytes:  maxBytes,
+		index:     make(map[uint64]uint64),
+		OnEvicted: onEvicted,
+	}
+}
+
+// segmentSize 选择分段大小：约为上限的1/16，太小的缓存至少分为4段
+func segmentSize(maxBytes int64) int {
+	if maxBytes <= 0 {
+		return maxSegmentSize
+	}
+	size := maxBytes / 16
+	if size < minSegmentSize {
+		size = minSegmentSize
+		if size > maxBytes/4 {
+			size = maxBytes / 4
+		}
+	}
+	if size > maxSegmentSize {
+		size = maxSegmentSize
+	}
+	if size < headerSize+1 {
+		size = headerSize + 1
+	}
+	return int(size)
+}
+
+// hash 是内联的64位FNV-1a，避免把key转换为[]byte
+func hash(key string) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(key); i++ {
+		h ^= uint64(key[i])
+		h *= 1099511628211
+	}
+	return h
+}
+
+// record 返回位置loc处的记录所在的分段和偏移
+func (c *Cache) record(loc uint64) (seg []byte, off int) {
+	return c.segs[uint32(loc>>32)-c.firstID], int(uint32(loc))
+}
+
+// lookup 找到key的记录，hash冲突的其他key视为不存在
+func (c *Cache) lookup(key string) (seg []byte, off int, ok bool) {
+	loc, ok := c.index[hash(key)]
+	if !ok {
+		return nil, 0, false
+	}
+	seg, off = c.record(loc)
+	if !keyEquals(seg, off, key) {
+		return nil, 0, false
+	}
+	return seg, off, true
+}
+
+// keyEquals 比较记录的key，不会分配内存
+func keyEquals(seg []byte, off int, key string) bool {
+	keyLen := int(binary.LittleEndian.Uint32(seg[off+8:]))
+	return string(seg[off+headerSize:off+headerSize+keyLen]) == key
+}
+
+func recordKey(seg []byte, off int) string {
+	keyLen := int(binary.LittleEndian.Uint32(seg[off+8:]))
+	return string(seg[off+headerSize : off+headerSize+keyLen])
+}
+
+func recordValue(seg []byte, off int) []byte {
+	keyLen := int(binary.LittleEndian.Uint32(seg[off+8:]))
+	valueLen := int(binary.LittleEndian.Uint32(seg[off+12:]))
+	start := off + headerSize + keyLen
+	return seg[start : start+valueLen]
+}
+
+func recordSize(seg []byte, off int) int {
+	return headerSize + int(binary.LittleEndian.Uint32(seg[off+8:])) + int(binary.LittleEndian.Uint32(seg[off+12:]))
+}
+
+// Get returns a copy of the value of key and marks it accessed.
+func (c *Cache) Get(key string) ([]byte, bool) {
+	seg, off, ok := c.lookup(key)
+	if !ok {
+		return nil, false
+	}
+	seg[off+16] |= flagAccessed
+	return append([]byte(nil), recordValue(seg, off)...), true
+}
+
+// Peek returns a copy of the value of key without marking it accessed.
+func (c *Cache) Peek(key string) ([]byte, bool) {
+	seg, off, ok := c.lookup(key)
+	if !ok {
+		return nil, false
+	}
+	return append([]byte(nil), recordValue(seg, off)...), true
+}
+
+// Contains reports whether key is in the cache, without marking it accessed.
+func (c *Cache) Contains(key string) bool {
+	_, _, ok := c.lookup(key)
+	return ok
+}
+
+// Add 同时实现新增和修改的功能，修改时旧记录标记为删除，空间在分段被淘汰时回收
+func (c *Cache) Add(key string, value []byte) {
+	h := hash(key)
+	if loc, ok := c.index[h]; ok {
+		// 同一个key被覆盖，或者hash冲突的另一个key被挤掉
+		seg, off := c.record(loc)
+		c.removeRecord(h, seg, off, !keyEquals(seg, off, key))
+	}
+	if headerSize+len(key)+len(value) > c.segSize {
+		return
+	}
+	c.write(h, key, value)
+	c.shrink()
+}
+
+// write 把记录追加到最新的分段，空间不足时开始一个新分段
+func (c *Cache) write(h uint64, key string, value []byte) {
+	size := headerSize + len(key) + len(value)
+	if n := len(c.segs); n == 0 || len(c.segs[n-1])+size > c.segSize {
+		seg := c.spare
+		c.spare = nil
+		if seg == nil {
+			seg = make([]byte, 0, c.segSize)
+		}
+		c.segs = append(c.segs, seg)
+	}
+	n := len(c.segs) - 1
+	seg := c.segs[n]
+	off := len(seg)
+	var header [headerSize]byte
+	binary.LittleEndian.PutUint64(header[0:], h)
+	binary.LittleEndian.PutUint32(header[8:], uint32(len(key)))
+	binary.LittleEndian.PutUint32(header[12:], uint32(len(value)))
+	seg = append(seg, header[:]...)
+	seg = append(seg, key...)
+	seg = append(seg, value...)
+	c.segs[n] = seg
+	c.index[h] = uint64(c.firstID+uint32(n))<<32 | uint64(off)
+}
+
+// shrink 淘汰最旧的分段直到不超过上限，最新的分段总是保留
+func (c *Cache) shrink() {
+	for c.maxBytes != 0 && c.Bytes() > c.maxBytes && len(c.segs) > 1 {
+		c.evictSegment(c.policy == LRU)
+	}
+}
+
+// evictSegment 淘汰最旧的分段。secondChance 时被访问过的记录清除标记后
+// 复制到最新的分段，下次轮到时如果没有再被访问就会被淘汰
+func (c *Cache) evictSegment(secondChance bool) {
+	seg := c.segs[0]
+	id := c.firstID
+	c.segs[0] = nil
+	c.segs = c.segs[1:]
+	c.firstID++
+
+	type survivor struct {
+		h     uint64
+		key   string
+		value []byte
+	}
+	var survivors []survivor
+	for off := 0; off < len(seg); off += recordSize(seg, off) {
+		if seg[off+16]&flagDeleted != 0 {
+			continue
+		}
+		h := binary.LittleEndian.Uint64(seg[off:])
+		if loc, ok := c.index[h]; !ok || loc != uint64(id)<<32|uint64(off) {
+			continue
+		}
+		delete(c.index, h)
+		if secondChance && seg[off+16]&flagAccessed != 0 {
+			value := append([]byte(nil), recordValue(seg, off)...)
+			survivors = append(survivors, survivor{h, recordKey(seg, off), value})
+			continue
+		}
+		if c.OnEvicted != nil {
+			c.OnEvicted(recordKey(seg, off), recordValue(seg, off))
+		}
+	}
+	if c.spare == nil && cap(seg) == c.segSize {
+		c.spare = seg[:0]
+	}
+	for _, s := range survivors {
+		c.write(s.h, s.key, s.value)
+	}
+}
+
+// RemoveOldest evicts the oldest segment with all its records, without
+// second chances, and releases its memory.
+func (c *Cache) RemoveOldest() {
+	if len(c.segs) == 0 {
+		return
+	}
+	c.evictSegment(false)
+	c.spare = nil
+	if len(c.segs) == 0 {
+		c.firstID = 0
+	}
+}
+
+// Remove removes the provided key from the cache.
+func (c *Cache) Remove(key string) bool {
+	seg, off, ok := c.lookup(key)
+	if !ok {
+		return false
+	}
+	c.removeRecord(hash(key), seg, off, true)
+	return true
+}
+
+func (c *Cache) removeRecord(h uint64, seg []byte, off int, notify bool) {
+	seg[off+16] |= flagDeleted
+	delete(c.index, h)
+	if notify && c.OnEvicted != nil {
+		c.OnEvicted(recordKey(seg, off), recordValue(seg, off))
+	}
+}
+
+func (c *Cache) Len() int {
+	return len(c.index)
+}
+
+// Bytes returns the memory currently used by the cache: the allocated
+// segments, including space of removed records not yet reclaimed, and
+// the index. It grows by a whole segment at a time, when a record does
+// not fit in the newest one.
+func (c *Cache) Bytes() int64 {
+	return int64(len(c.segs))*int64(c.segSize) + int64(len(c.index))*indexEntrySize
+}
+
+// Range calls fn for each entry from the oldest to the newest, without
+// marking them accessed. value is only valid during the call. Iteration
+// stops when fn returns false.
+func (c *Cache) Range(fn func(key string, value []byte) bool) {
+	for i, seg := range c.segs {
+		id := c.firstID + uint32(i)
+		for off := 0; off < len(seg); off += recordSize(seg, off) {
+			if seg[off+16]&flagDeleted != 0 {
+				continue
+			}
+			if loc := c.index[binary.LittleEndian.Uint64(seg[off:])]; loc != uint64(id)<<32|uint64(off) {
+				continue
+			}
+			if !fn(recordKey(seg, off), recordValue(seg, off)) {
+				return
+			}
+		}
+	}
+}
+
+// Keys returns the keys in the cache from the oldest to the newest.
+func (c *Cache) Keys() []string {
+	keys := make([]string, 0, len(c.index))
+	c.Range(func(key string, value []byte) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+// Resize changes the memory limit to maxBytes, 0 meaning no limit, and
+// evicts segments until the cache fits. The segment size is kept. It
+// returns the number of entries evicted.
+func (c *Cache) Resize(maxBytes int64) int {
+	c.maxBytes = maxBytes
+	n := len(c.index)
+	for c.maxBytes != 0 && c.Bytes() > c.maxBytes && len(c.segs) > 0 {
+		c.RemoveOldest()
+	}
+	return n - len(c.index)
+}
+
+// Purge removes all entries, calling OnEvicted for each of them.
+func (c *Cache) Purge() {
+	if c.OnEvicted != nil {
+		c.Range(func(key string, value []byte) bool {
+			c.OnEvicted(key, value)
+			return true
+		})
+	}
+	c.segs, c.spare, c.firstID = nil, nil, 0
+	c.index = make(map[uint64]uint64)
+}
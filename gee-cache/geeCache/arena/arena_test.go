@@ -0,0 +1,149 @@
+package arena
+
+import (
+	"fmt"
+	"geeCache/lru"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	c := NewCache(0, FIFO, nil)
+	c.Add("key1", []byte("1234"))
+	if v, ok := c.Get("key1"); !ok || string(v) != "1234" {
+		t.Fatalf("cache hit key1=1234 failed")
+	}
+	if _, ok := c.Get("key2"); ok {
+		t.Fatalf("cache miss key2 failed")
+	}
+	c.Add("key1", []byte("56"))
+	if v, ok := c.Peek("key1"); !ok || string(v) != "56" || c.Len() != 1 {
+		t.Fatalf("expect key1 updated to 56, got %q, len %d", v, c.Len())
+	}
+	if !reflect.DeepEqual(c.Keys(), []string{"key1"}) {
+		t.Fatalf("expect the old record skipped, got %v", c.Keys())
+	}
+}
+
+// fill 依次加入key，每次加入后检查 done，返回加入的数量
+func fill(c *Cache, done func() bool) int {
+	for i := 0; i < 1000; i++ {
+		c.Add(fmt.Sprintf("k%03d", i), make([]byte, 100))
+		if done() {
+			return i + 1
+		}
+	}
+	return 1000
+}
+
+func TestFIFO(t *testing.T) {
+	var evicted []string
+	c := NewCache(2048, FIFO, func(key string, value []byte) {
+		evicted = append(evicted, key)
+	})
+	n := fill(c, func() bool { return len(evicted) > 0 })
+	if n == 0 || c.Bytes() > 2048 {
+		t.Fatalf("expect eviction within the limit, used %d bytes after %d adds", c.Bytes(), n)
+	}
+	// 整个分段一起淘汰，最早加入的key最先被淘汰
+	if evicted[0] != "k000" || c.Contains("k000") || !c.Contains(fmt.Sprintf("k%03d", n-1)) {
+		t.Fatalf("expect the oldest keys evicted first, got %v", evicted)
+	}
+	keys := c.Keys()
+	if keys[len(keys)-1] != fmt.Sprintf("k%03d", n-1) || len(keys)+len(evicted) != n {
+		t.Fatalf("unexpected keys %v after evicting %v", keys, evicted)
+	}
+}
+
+func TestLRUSecondChance(t *testing.T) {
+	for _, tt := range []struct {
+		policy Policy
+		keep   bool
+	}{{FIFO, false}, {LRU, true}} {
+		c := NewCache(2048, tt.policy, nil)
+		c.Add("hot", []byte("v"))
+		c.Get("hot")
+		fill(c, func() bool { return !c.Contains("k000") })
+		if c.Contains("hot") != tt.keep {
+			t.Fatalf("policy %v: expect hot kept=%v", tt.policy, tt.keep)
+		}
+	}
+}
+
+func TestRemove(t *testing.T) {
+	var evicted []string
+	c := NewCache(0, FIFO, func(key string, value []byte) {
+		evicted = append(evicted, key)
+	})
+	c.Add("k1", []byte("1"))
+	c.Add("k2", []byte("2"))
+	if !c.Remove("k1") || c.Remove("k1") {
+		t.Fatal("Remove k1 failed")
+	}
+	if c.Contains("k1") || c.Len() != 1 || !reflect.DeepEqual(evicted, []string{"k1"}) {
+		t.Fatalf("expect only k2 left, got %v", c.Keys())
+	}
+}
+
+func TestTooLarge(t *testing.T) {
+	c := NewCache(2048, FIFO, nil)
+	c.Add("big", []byte("small"))
+	c.Add("big", make([]byte, 1024))
+	if c.Contains("big") {
+		t.Fatal("expect a value larger than a segment not cached")
+	}
+}
+
+func TestResizeAndPurge(t *testing.T) {
+	var evicted int
+	c := NewCache(0, LRU, func(key string, value []byte) { evicted++ })
+	for i := 0; i < 100; i++ {
+		c.Add(fmt.Sprint(i), make([]byte, 100))
+	}
+	before := c.Len()
+	n := c.Resize(1 << 10)
+	if c.Bytes() > 1<<10 || n != before-c.Len() || n != evicted {
+		t.Fatalf("expect resize to evict down to the limit, got %d bytes, %d evicted", c.Bytes(), n)
+	}
+	c.Purge()
+	if c.Len() != 0 || c.Bytes() != 0 || evicted != before {
+		t.Fatalf("expect empty cache, got len %d bytes %d", c.Len(), c.Bytes())
+	}
+	c.Add("k", []byte("v"))
+	if v, ok := c.Get("k"); !ok || string(v) != "v" {
+		t.Fatal("expect the cache usable after Purge")
+	}
+}
+
+type bytesValue []byte
+
+func (b bytesValue) Len() int { return len(b) }
+
+// 比较大量条目时一次GC的耗时：lru的每个条目都有多个需要扫描的指针，
+// arena的分段和索引中没有指针
+func BenchmarkGC(b *testing.B) {
+	const n = 1 << 20
+	b.Run("lru", func(b *testing.B) {
+		c := lru.NewCache(0, nil)
+		for i := 0; i < n; i++ {
+			c.Add(fmt.Sprintf("key%d", i), bytesValue(make([]byte, 16)))
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			runtime.GC()
+		}
+		runtime.KeepAlive(c)
+	})
+	b.Run("arena", func(b *testing.B) {
+		c := NewCache(0, LRU, nil)
+		for i := 0; i < n; i++ {
+			c.Add(fmt.Sprintf("key%d", i), make([]byte, 16))
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			runtime.GC()
+		}
+		runtime.KeepAlive(c)
+	})
+}
@@ -0,0 +1,182 @@
+package geeCache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBreakerFailureRate = 0.5
+	defaultBreakerMinRequests = 10
+	defaultBreakerWindow      = 10 * time.Second
+	defaultBreakerCooldown    = 5 * time.Second
+)
+
+// ErrCircuitOpen is returned by a peer whose circuit breaker is open.
+var ErrCircuitOpen = errors.New("geecache: circuit breaker is open")
+
+// BreakerState is the state of a peer's circuit breaker.
+type BreakerState int
+
+const (
+	BreakerClosed   BreakerState = iota // 正常访问
+	BreakerOpen                         // 直接失败，等待冷却
+	BreakerHalfOpen                     // 冷却结束，放行一个探测请求
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// MarshalText makes the state readable in JSON.
+func (s BreakerState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText parses a state written by MarshalText.
+func (s *BreakerState) UnmarshalText(text []byte) error {
+	for _, state := range []BreakerState{BreakerClosed, BreakerOpen, BreakerHalfOpen} {
+		if string(text) == state.String() {
+			*s = state
+			return nil
+		}
+	}
+	return errors.New("geecache: unknown breaker state " + string(text))
+}
+
+// breaker 是一个按失败率熔断的断路器，nil断路器总是放行
+type breaker struct {
+	failureRate float64       // 窗口内失败率达到该值时熔断
+	minRequests int           // 窗口内请求数达到该值后才计算失败率
+	window      time.Duration // 统计窗口
+	cooldown    time.Duration // 熔断后多久进入半开状态
+	onChange    func(from, to BreakerState)
+	now         func() time.Time
+
+	mu          sync.Mutex
+	state       BreakerState
+	requests    int
+	failures    int
+	windowStart time.Time
+	openedAt    time.Time
+	probing     bool // 半开状态下是否已有探测请求
+}
+
+func newBreaker(o *HTTPPoolOptions, onChange func(from, to BreakerState)) *breaker {
+	b := &breaker{
+		failureRate: o.BreakerFailureRate,
+		minRequests: o.BreakerMinRequests,
+		window:      o.BreakerWindow,
+		cooldown:    o.BreakerCooldown,
+		onChange:    onChange,
+		now:         time.Now,
+	}
+	if b.failureRate <= 0 {
+		b.failureRate = defaultBreakerFailureRate
+	}
+	if b.minRequests <= 0 {
+		b.minRequests = defaultBreakerMinRequests
+	}
+	if b.window <= 0 {
+		b.window = defaultBreakerWindow
+	}
+	if b.cooldown <= 0 {
+		b.cooldown = defaultBreakerCooldown
+	}
+	return b
+}
+
+// State returns the current state of the breaker.
+func (b *breaker) State() BreakerState {
+	if b == nil {
+		return BreakerClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// allow 判断是否可以发起请求，允许时调用方必须在请求结束后调用 record
+func (b *breaker) allow() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	switch b.state {
+	case BreakerOpen:
+		if now.Sub(b.openedAt) < b.cooldown {
+			return ErrCircuitOpen
+		}
+		b.setState(BreakerHalfOpen)
+		fallthrough
+	case BreakerHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+	default:
+		if now.Sub(b.windowStart) > b.window {
+			b.windowStart, b.requests, b.failures = now, 0, 0
+		}
+	}
+	return nil
+}
+
+// record 记录一次请求的结果。ctx被取消的请求(例如对冲请求中输掉的一方)
+// 说明不了节点的好坏，不计入结果，但仍要结束探测，让下一个请求重新探测
+func (b *breaker) record(ctx context.Context, failed bool) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerHalfOpen {
+		b.probing = false
+		if ctx.Err() != nil {
+			return
+		}
+		if failed {
+			b.open()
+		} else {
+			b.windowStart, b.requests, b.failures = b.now(), 0, 0
+			b.setState(BreakerClosed)
+		}
+		return
+	}
+	if b.state != BreakerClosed || ctx.Err() != nil {
+		return
+	}
+	b.requests++
+	if failed {
+		b.failures++
+	}
+	if b.requests >= b.minRequests && float64(b.failures) >= b.failureRate*float64(b.requests) {
+		b.open()
+	}
+}
+
+func (b *breaker) open() {
+	b.openedAt = b.now()
+	b.setState(BreakerOpen)
+}
+
+func (b *breaker) setState(to BreakerState) {
+	if from := b.state; from != to {
+		b.state = to
+		if b.onChange != nil {
+			b.onChange(from, to)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package geeCache
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestBreaker(now *time.Time, transitions *[]string) *breaker {
+	b := newBreaker(&HTTPPoolOptions{
+		BreakerFailureRate: 0.5,
+		BreakerMinRequests: 4,
+		BreakerWindow:      time.Second,
+		BreakerCooldown:    time.Second,
+	}, func(from, to BreakerState) {
+		*transitions = append(*transitions, from.String()+"->"+to.String())
+	})
+	b.now = func() time.Time { return *now }
+	return b
+}
+
+func TestBreakerOpensOnFailureRate(t *testing.T) {
+	now := time.Now()
+	var transitions []string
+	b := newTestBreaker(&now, &transitions)
+
+	for _, failed := range []bool{false, true, false, true} {
+		if err := b.allow(); err != nil {
+			t.Fatalf("closed breaker should allow requests, got %v", err)
+		}
+		b.record(context.Background(), failed)
+	}
+	if b.State() != BreakerOpen {
+		t.Fatalf("expect open after 50%% failures, got %s", b.State())
+	}
+	if err := b.allow(); err != ErrCircuitOpen {
+		t.Fatalf("open breaker should fail fast, got %v", err)
+	}
+
+	// 冷却之后放行一个探测请求，探测成功则关闭
+	now = now.Add(time.Second)
+	if err := b.allow(); err != nil {
+		t.Fatalf("expect a probe after the cooldown, got %v", err)
+	}
+	if err := b.allow(); err != ErrCircuitOpen {
+		t.Fatalf("only one probe may be in flight, got %v", err)
+	}
+	b.record(context.Background(), false)
+	if b.State() != BreakerClosed {
+		t.Fatalf("expect closed after a successful probe, got %s", b.State())
+	}
+
+	expect := []string{"closed->open", "open->half-open", "half-open->closed"}
+	if len(transitions) != len(expect) {
+		t.Fatalf("expect transitions %v, got %v", expect, transitions)
+	}
+	for i := range expect {
+		if transitions[i] != expect[i] {
+			t.Fatalf("expect transitions %v, got %v", expect, transitions)
+		}
+	}
+}
+
+func TestBreakerFailedProbeReopens(t *testing.T) {
+	now := time.Now()
+	var transitions []string
+	b := newTestBreaker(&now, &transitions)
+	for i := 0; i < 4; i++ {
+		b.allow()
+		b.record(context.Background(), true)
+	}
+	now = now.Add(time.Second)
+	b.allow()
+	b.record(context.Background(), true)
+	if b.State() != BreakerOpen {
+		t.Fatalf("expect open after a failed probe, got %s", b.State())
+	}
+	if err := b.allow(); err != ErrCircuitOpen {
+		t.Fatalf("expect a new cooldown after a failed probe, got %v", err)
+	}
+}
+
+func TestBreakerIgnoresCancelled(t *testing.T) {
+	now := time.Now()
+	var transitions []string
+	b := newTestBreaker(&now, &transitions)
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// 被取消的请求不计入失败率
+	for i := 0; i < 4; i++ {
+		b.allow()
+		b.record(cancelled, true)
+	}
+	if b.State() != BreakerClosed {
+		t.Fatalf("cancelled requests should not open the breaker, got %s", b.State())
+	}
+
+	for i := 0; i < 4; i++ {
+		b.allow()
+		b.record(context.Background(), true)
+	}
+	now = now.Add(time.Second)
+	// 被取消的探测既不关闭也不打开断路器，下一个请求重新探测
+	if err := b.allow(); err != nil {
+		t.Fatalf("expect a probe after the cooldown, got %v", err)
+	}
+	b.record(cancelled, false)
+	if b.State() != BreakerHalfOpen {
+		t.Fatalf("a cancelled probe should leave the breaker half-open, got %s", b.State())
+	}
+	if err := b.allow(); err != nil {
+		t.Fatalf("expect a new probe after a cancelled one, got %v", err)
+	}
+}
+
+func TestBreakerWindow(t *testing.T) {
+	now := time.Now()
+	var transitions []string
+	b := newTestBreaker(&now, &transitions)
+	for i := 0; i < 3; i++ {
+		b.allow()
+		b.record(context.Background(), true)
+	}
+	// 窗口过期后重新计数，之前的失败不再计算
+	now = now.Add(2 * time.Second)
+	b.allow()
+	b.record(context.Background(), true)
+	if b.State() != BreakerClosed {
+		t.Fatalf("failures of an expired window should not count, got %s", b.State())
+	}
+}
+
+func TestLoadFallsBackWhenBreakerOpen(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		http.Error(w, "broken", http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	self := "http://self"
+	pool := NewHTTPPoolOpts(self, &HTTPPoolOptions{
+		BreakerFailureRate: 0.5,
+		BreakerMinRequests: 2,
+		BreakerCooldown:    time.Minute,
+		Logger:             DiscardLogger,
+	})
+	pool.Set(self, srv.URL)
+	gee := NewGroupOpts("breaker-fallback", GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("local:" + key), nil
+		}), 2<<10, &GroupOptions{Logger: DiscardLogger})
+	gee.RegisterPeers(pool)
+
+	var keys []string
+	for i := 0; len(keys) < 3; i++ {
+		if key := fmt.Sprintf("key%d", i); pool.Owners(key)[0] == srv.URL {
+			keys = append(keys, key)
+		}
+	}
+	// 前两次请求到达peer并失败，断路器打开；之后不再访问peer，都在本地加载
+	for i, key := range keys {
+		if v, err := gee.Get(key); err != nil || v.String() != "local:"+key {
+			t.Fatalf("expect %s loaded locally, got %v %v", key, v, err)
+		}
+		if want := int32(min(i+1, 2)); atomic.LoadInt32(&hits) != want {
+			t.Fatalf("after %d gets expect %d requests to the peer, got %d", i+1, want, hits)
+		}
+	}
+	if state := pool.BreakerStates()[srv.URL]; state != BreakerOpen {
+		t.Fatalf("expect the breaker open, got %s", state)
+	}
+	if s := gee.Stats.Snapshot(); s.LocalLoads != 3 || s.PeerErrors != 3 {
+		t.Fatalf("expect 3 local loads after 3 peer errors, got %+v", s)
+	}
+}
@@ -0,0 +1,70 @@
+package geeCache
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Budget is a memory budget shared by several groups. When the caches
+// drawing from it use more than maxBytes in total, the oldest entries of
+// the group using the most memory relative to its priority are evicted.
+type Budget struct {
+	mu       sync.Mutex
+	maxBytes int64
+	used     atomic.Int64   // 所有cache占用的内存之和，随每次增删增量更新
+	caches   map[*cache]int // cache -> priority
+}
+
+// NewBudget creates a budget of maxBytes shared by the groups created
+// with it in their GroupOptions.
+func NewBudget(maxBytes int64) *Budget {
+	return &Budget{
+		maxBytes: maxBytes,
+		caches:   make(map[*cache]int),
+	}
+}
+
+func (b *Budget) register(c *cache, priority int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.caches[c] = priority
+}
+
+func (b *Budget) unregister(c *cache) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.caches, c)
+}
+
+// Bytes returns the memory used by all groups drawing from the budget.
+func (b *Budget) Bytes() int64 {
+	return b.used.Load()
+}
+
+// victim 返回按优先级加权后占用内存最多的cache
+func (b *Budget) victim() (victim *cache) {
+	var worst float64
+	for c, priority := range b.caches {
+		n := c.bytes()
+		if weighted := float64(n) / float64(priority); n > 0 && weighted > worst {
+			worst, victim = weighted, c
+		}
+	}
+	return
+}
+
+// enforce 淘汰数据直到总占用不超过预算，只有超出预算时才需要遍历各个cache
+func (b *Budget) enforce() {
+	if b.used.Load() <= b.maxBytes {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for b.used.Load() > b.maxBytes {
+		victim := b.victim()
+		if victim == nil {
+			return
+		}
+		victim.removeOldest()
+	}
+}
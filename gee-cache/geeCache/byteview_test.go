@@ -0,0 +1,63 @@
+package geeCache
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func views(s string) map[string]ByteView {
+	return map[string]ByteView{
+		"bytes":  NewByteView([]byte(s)),
+		"string": NewStringView(s),
+	}
+}
+
+func TestByteViewAccessors(t *testing.T) {
+	const s = "hello, geecache"
+	for name, v := range views(s) {
+		if v.Len() != len(s) || v.String() != s || string(v.ByteSlice()) != s {
+			t.Errorf("%s: Len/String/ByteSlice mismatch", name)
+		}
+		if v.At(4) != 'o' {
+			t.Errorf("%s: At(4) = %q", name, v.At(4))
+		}
+		if got := v.Slice(7, 10).String(); got != "gee" {
+			t.Errorf("%s: Slice(7, 10) = %q", name, got)
+		}
+		if got := v.SliceFrom(7).String(); got != "geecache" {
+			t.Errorf("%s: SliceFrom(7) = %q", name, got)
+		}
+		if !v.EqualString(s) || !v.EqualBytes([]byte(s)) || v.EqualString(s+"!") {
+			t.Errorf("%s: EqualString/EqualBytes mismatch", name)
+		}
+		for other, w := range views(s) {
+			if !v.Equal(w) {
+				t.Errorf("%s should equal %s", name, other)
+			}
+		}
+		if b, err := ioutil.ReadAll(v.Reader()); err != nil || string(b) != s {
+			t.Errorf("%s: Reader = %q, %v", name, b, err)
+		}
+		var buf bytes.Buffer
+		if n, err := v.WriteTo(&buf); err != nil || n != int64(len(s)) || buf.String() != s {
+			t.Errorf("%s: WriteTo = %d %q, %v", name, n, buf.String(), err)
+		}
+		p := make([]byte, 4)
+		if n, err := v.ReadAt(p, int64(len(s)-3)); n != 3 || err != io.EOF || string(p[:n]) != "che" {
+			t.Errorf("%s: ReadAt = %d %q, %v", name, n, p[:n], err)
+		}
+	}
+}
+
+func TestByteViewIsImmutable(t *testing.T) {
+	b := []byte("630")
+	v := NewByteView(b)
+	b[0] = '9'
+	out := v.ByteSlice()
+	out[1] = '9'
+	if v.String() != "630" {
+		t.Fatalf("view was modified through its input or output: %s", v)
+	}
+}
@@ -1,33 +1,279 @@
 package geeCache
 
 import (
+	"geeCache/arena"
+	"geeCache/clock"
 	"geeCache/lru"
+	"strings"
 	"sync"
+	"sync/atomic"
 )
 
+// Eviction selects the replacement policy of a group's cache.
+type Eviction int
+
+const (
+	// EvictLRU evicts the least recently used entry. Every hit reorders
+	// the cache, so gets are serialized.
+	EvictLRU Eviction = iota
+	// EvictClock approximates LRU with the CLOCK algorithm. A hit only
+	// sets a reference bit, so gets run concurrently.
+	EvictClock
+	// EvictArenaFIFO keeps entries in large byte segments indexed by a
+	// pointer-free map, so that millions of entries add little GC work,
+	// and evicts them in the order they were added. Every hit copies the
+	// value out of the segment.
+	EvictArenaFIFO
+	// EvictArenaLRU is like EvictArenaFIFO, but entries read since they
+	// were added are kept when their segment is evicted, approximating LRU.
+	//
+	// The arena evictions count memory by whole segments of about 1/16 of
+	// the cache size, so a shared Budget sees them grow and shrink in
+	// steps of a segment.
+	EvictArenaLRU
+)
+
+// storage 是cache底层的存储，lru.Cache、clock.Cache 和 arenaStore 都实现了它
+type storage interface {
+	Get(key string) (lru.Value, bool)
+	Contains(key string) bool
+	Add(key string, value lru.Value)
+	RemoveOldest()
+	Remove(key string) bool
+	Range(fn func(key string, value lru.Value) bool)
+	Resize(maxBytes int64) int
+	Len() int
+	Bytes() int64
+}
+
+// arenaStore 让 arena.Cache 满足 storage，值以字节的形式保存在分段中
+type arenaStore struct {
+	*arena.Cache
+}
+
+func (s arenaStore) Get(key string) (lru.Value, bool) {
+	b, ok := s.Cache.Get(key)
+	if !ok {
+		return nil, false
+	}
+	return ByteView{b: b}, true
+}
+
+func (s arenaStore) Add(key string, value lru.Value) {
+	s.Cache.Add(key, value.(ByteView).bytes())
+}
+
+// Range 传给fn的值是复制出来的，调用方可以在遍历之后继续使用
+func (s arenaStore) Range(fn func(key string, value lru.Value) bool) {
+	s.Cache.Range(func(key string, value []byte) bool {
+		return fn(key, NewByteView(value))
+	})
+}
+
 type cache struct {
-	mu         sync.Mutex
-	lru        *lru.Cache
+	mu         sync.RWMutex
+	store      storage
+	eviction   Eviction
 	cacheBytes int64
+	maxEntries int // 为0表示不限制条目数
+	nhit, nget atomic.Int64
+	nevict     int64   // number of evictions
+	budget     *Budget // 多个group共享的内存预算，可以为nil
+	charged    int64   // 已经计入budget的内存
+}
+
+func (c *cache) stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := CacheStats{
+		Gets:      c.nget.Load(),
+		Hits:      c.nhit.Load(),
+		Evictions: c.nevict,
+		MaxBytes:  c.cacheBytes,
+	}
+	if c.store != nil {
+		s.Bytes = c.store.Bytes()
+		s.Items = int64(c.store.Len())
+	}
+	return s
+}
+
+// newStore 按淘汰策略创建存储，调用时需持有写锁
+func (c *cache) newStore() storage {
+	onEvicted := func(key string, value lru.Value) {
+		c.nevict++
+	}
+	switch c.eviction {
+	case EvictArenaFIFO, EvictArenaLRU:
+		policy := arena.FIFO
+		if c.eviction == EvictArenaLRU {
+			policy = arena.LRU
+		}
+		return arenaStore{arena.NewCache(c.cacheBytes, policy, func(key string, value []byte) {
+			c.nevict++
+		})}
+	case EvictClock:
+		s := clock.NewCache(c.cacheBytes, onEvicted)
+		s.MaxEntries = c.maxEntries
+		return s
+	default:
+		s := lru.NewCache(c.cacheBytes, onEvicted)
+		s.MaxEntries = c.maxEntries
+		return s
+	}
 }
 
 func (c *cache) add(key string, value ByteView) {
+	c.mu.Lock()
+	if c.store == nil {
+		c.store = c.newStore()
+	}
+	c.store.Add(key, value)
+	c.charge()
+	budget := c.budget
+	c.mu.Unlock()
+	// 释放锁之后再检查预算，预算可能会淘汰其他group(包括自己)的数据
+	if budget != nil {
+		budget.enforce()
+	}
+}
+
+// charge 把上次计入之后内存占用的变化计入budget，调用时需持有写锁
+func (c *cache) charge() {
+	if c.budget == nil {
+		return
+	}
+	var n int64
+	if c.store != nil {
+		n = c.store.Bytes()
+	}
+	c.budget.used.Add(n - c.charged)
+	c.charged = n
+}
+
+func (c *cache) bytes() int64 {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	if c.lru == nil {
-		c.lru = lru.NewCache(c.cacheBytes, nil)
+	if c.store == nil {
+		return 0
 	}
-	c.lru.Add(key, value)
+	return c.store.Bytes()
 }
 
-func (c *cache) get(key string) (value ByteView, ok bool) {
+func (c *cache) removeOldest() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	if c.lru == nil {
+	if c.store != nil {
+		c.store.RemoveOldest()
+		c.charge()
+	}
+}
+
+func (c *cache) get(key string) (value ByteView, ok bool) {
+	// CLOCK 的 Get 只原子地设置引用位，读锁就足够了
+	if c.eviction == EvictClock {
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+	} else {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+	}
+	c.nget.Add(1)
+	if c.store == nil {
 		return
 	}
-	if v, ok := c.lru.Get(key); ok {
+	if v, ok := c.store.Get(key); ok {
+		c.nhit.Add(1)
 		return v.(ByteView), ok
 	}
 	return
 }
+
+// contains 判断key是否在缓存中，不计入命中率也不更新访问顺序
+func (c *cache) contains(key string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.store != nil && c.store.Contains(key)
+}
+
+// resize 修改内存上限并淘汰超出的数据，返回淘汰的条目数
+func (c *cache) resize(cacheBytes int64) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cacheBytes = cacheBytes
+	if c.store == nil {
+		return 0
+	}
+	defer c.charge()
+	return c.store.Resize(cacheBytes)
+}
+
+func (c *cache) remove(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.store == nil {
+		return false
+	}
+	defer c.charge()
+	return c.store.Remove(key)
+}
+
+// removePrefix 删除所有以prefix开头的key，返回删除的数量
+func (c *cache) removePrefix(prefix string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.store == nil {
+		return 0
+	}
+	var keys []string
+	c.store.Range(func(key string, value lru.Value) bool {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	for _, key := range keys {
+		c.store.Remove(key)
+	}
+	c.charge()
+	return len(keys)
+}
+
+// purge 清空缓存，返回被清除的条目数
+func (c *cache) purge() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.store == nil {
+		return 0
+	}
+	n := c.store.Len()
+	c.store = nil
+	c.charge()
+	return n
+}
+
+// release 清空缓存并退出预算，之后写入的数据不再计入预算
+func (c *cache) release() {
+	c.mu.Lock()
+	c.store = nil
+	c.charge()
+	budget := c.budget
+	c.budget = nil
+	c.mu.Unlock()
+	// 预算淘汰数据时先锁预算再锁cache，这里不能在持有cache锁时锁预算
+	if budget != nil {
+		budget.unregister(c)
+	}
+}
+
+// rangeEntries 在持有锁的情况下遍历缓存，fn 中不应做耗时操作
+func (c *cache) rangeEntries(fn func(key string, value ByteView) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.store == nil {
+		return
+	}
+	c.store.Range(func(key string, value lru.Value) bool {
+		return fn(key, value.(ByteView))
+	})
+}
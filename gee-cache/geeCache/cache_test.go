@@ -0,0 +1,89 @@
+package geeCache
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestEvictClock(t *testing.T) {
+	loads := 0
+	gee := NewGroupOpts("clock", GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			return []byte(db[key]), nil
+		}), 2<<10, &GroupOptions{Eviction: EvictClock, MaxEntries: 2})
+
+	gee.Get("Tom")
+	gee.Get("Jack")
+	// Tom 被访问过，获得第二次机会，加入 Sam 时淘汰 Jack
+	if v, err := gee.Get("Tom"); err != nil || v.String() != "630" || loads != 2 {
+		t.Fatalf("expect Tom from cache, got %v %v after %d loads", v, err, loads)
+	}
+	gee.Get("Sam")
+	if !gee.Cached("Tom") || gee.Cached("Jack") || !gee.Cached("Sam") {
+		t.Fatal("expect Jack evicted by the clock")
+	}
+	if s := gee.CacheStats(); s.Items != 2 || s.Evictions != 1 || s.Hits != 1 {
+		t.Fatalf("unexpected cache stats %+v", s)
+	}
+}
+
+func TestEvictArena(t *testing.T) {
+	loads := 0
+	gee := NewGroupOpts("arena", GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			return []byte(db[key]), nil
+		}), 2<<10, &GroupOptions{Eviction: EvictArenaLRU})
+
+	for i := 0; i < 2; i++ {
+		for k, v := range db {
+			if view, err := gee.Get(k); err != nil || view.String() != v {
+				t.Fatalf("expect %s=%s, got %v %v", k, v, view, err)
+			}
+		}
+	}
+	if loads != len(db) || gee.CacheStats().Items != int64(len(db)) {
+		t.Fatalf("expect each key loaded once, got %d loads", loads)
+	}
+	if !gee.Evict("Tom") || gee.Cached("Tom") {
+		t.Fatal("expect Tom evicted")
+	}
+	var keys []string
+	gee.mainCache.rangeEntries(func(key string, value ByteView) bool {
+		keys = append(keys, key)
+		return value.String() == db[key]
+	})
+	if len(keys) != len(db)-1 {
+		t.Fatalf("expect the remaining keys in range, got %v", keys)
+	}
+	if n := gee.Resize(1); n != len(db)-1 || gee.CacheStats().Items != 0 {
+		t.Fatalf("expect resize to evict all, got %d", n)
+	}
+}
+
+// 比较几种淘汰策略下并发命中的性能
+func BenchmarkCacheGetParallel(b *testing.B) {
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key%d", i)
+	}
+	for _, eviction := range []struct {
+		name string
+		e    Eviction
+	}{{"lru", EvictLRU}, {"clock", EvictClock}, {"arena", EvictArenaLRU}} {
+		b.Run(eviction.name, func(b *testing.B) {
+			c := &cache{eviction: eviction.e}
+			for _, k := range keys {
+				c.add(k, NewStringView(k))
+			}
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					c.get(keys[i%len(keys)])
+					i++
+				}
+			})
+		})
+	}
+}
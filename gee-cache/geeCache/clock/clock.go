@@ -0,0 +1,215 @@
+// Package clock implements a cache with CLOCK replacement, an
+// approximation of LRU in which a hit only sets a reference bit instead of
+// reordering a list. Get, Peek and Contains may therefore run concurrently
+// under a read lock.
+package clock
+
+import (
+	"geeCache/lru"
+	"sync/atomic"
+	"unsafe"
+)
+
+// Value is the same as lru.Value: Len() returns the memory the value uses.
+type Value = lru.Value
+
+type entry struct {
+	key   string
+	value Value
+	size  int64 // 加入时计入nbytes的大小，删除时原样减去
+	slot  int   // 在环上的位置
+	ref   int32 // 引用位，Get时原子地置1
+}
+
+// EntryOverhead is the memory the cache itself uses for each entry, on top
+// of the key and the value: the entry, its slot on the ring and its slot
+// in the map. It is an estimate for 64-bit platforms.
+var EntryOverhead = lru.AllocSize(unsafe.Sizeof(entry{})) + int64(unsafe.Sizeof(&entry{})) +
+	lru.MapEntrySize(unsafe.Sizeof("")+unsafe.Sizeof(&entry{}))
+
+// Cache 是CLOCK缓存。Get、Peek、Contains、Len、Bytes 之间可以并发调用，
+// 其余方法需要独占访问，即 Get 可以在读锁下调用，修改需要写锁
+type Cache struct {
+	// 允许使用的最大内存
+	maxBytes int64
+	// 当前已经使用的内存，包括每个条目的 EntryOverhead
+	nbytes int64
+	// 允许保存的最大条目数，为0表示不限制
+	MaxEntries int
+	// 环形数组，删除后留下的空位记录在free中，新条目优先复用
+	ring []*entry
+	free []int
+	// 时钟指针，指向下一个检查的位置
+	hand int
+	mp   map[string]*entry
+	// 记录被移除时的回调函数，可以为nil
+	OnEvicted func(key string, value Value)
+}
+
+func NewCache(maxBytes int64, onEvicted func(key string, value Value)) *Cache {
+	return &Cache{
+		maxBytes:  maxBytes,
+		mp:        make(map[string]*entry),
+		OnEvicted: onEvicted,
+	}
+}
+
+// Get returns the value of key and marks it recently used. It only sets
+// the entry's reference bit, so it is safe to call concurrently with
+// other Get calls.
+func (c *Cache) Get(key string) (Value, bool) {
+	if e, ok := c.mp[key]; ok {
+		if atomic.LoadInt32(&e.ref) == 0 {
+			atomic.StoreInt32(&e.ref, 1)
+		}
+		return e.value, true
+	}
+	return nil, false
+}
+
+// Peek returns the value of key without marking it recently used.
+func (c *Cache) Peek(key string) (Value, bool) {
+	if e, ok := c.mp[key]; ok {
+		return e.value, true
+	}
+	return nil, false
+}
+
+// Contains reports whether key is in the cache, without marking it recently used.
+func (c *Cache) Contains(key string) bool {
+	_, ok := c.mp[key]
+	return ok
+}
+
+// Add 同时实现新增和修改的功能，修改视为一次访问
+func (c *Cache) Add(key string, value Value) {
+	size := entrySize(key, value)
+	if e, ok := c.mp[key]; ok {
+		c.nbytes += size - e.size
+		e.value, e.size = value, size
+		atomic.StoreInt32(&e.ref, 1)
+	} else {
+		e := &entry{key: key, value: value, size: size}
+		if n := len(c.free); n > 0 {
+			e.slot = c.free[n-1]
+			c.free = c.free[:n-1]
+			c.ring[e.slot] = e
+		} else {
+			e.slot = len(c.ring)
+			c.ring = append(c.ring, e)
+		}
+		c.mp[key] = e
+		c.nbytes += size
+	}
+
+	for (c.maxBytes != 0 && c.nbytes > c.maxBytes) || (c.MaxEntries != 0 && len(c.mp) > c.MaxEntries) {
+		c.RemoveOldest()
+	}
+}
+
+// RemoveOldest evicts the entry chosen by the clock hand: the first entry
+// from the hand on whose reference bit is not set. Set bits passed on the
+// way are cleared, giving those entries a second chance.
+func (c *Cache) RemoveOldest() {
+	if len(c.mp) == 0 {
+		return
+	}
+	for {
+		if c.hand >= len(c.ring) {
+			c.hand = 0
+		}
+		e := c.ring[c.hand]
+		c.hand++
+		if e == nil {
+			continue
+		}
+		if atomic.LoadInt32(&e.ref) == 1 {
+			atomic.StoreInt32(&e.ref, 0)
+			continue
+		}
+		c.removeEntry(e)
+		return
+	}
+}
+
+// Remove removes the provided key from the cache.
+func (c *Cache) Remove(key string) bool {
+	if e, ok := c.mp[key]; ok {
+		c.removeEntry(e)
+		return true
+	}
+	return false
+}
+
+func (c *Cache) removeEntry(e *entry) {
+	c.ring[e.slot] = nil
+	c.free = append(c.free, e.slot)
+	delete(c.mp, e.key)
+	c.nbytes -= e.size
+	if c.OnEvicted != nil {
+		c.OnEvicted(e.key, e.value)
+	}
+}
+
+func (c *Cache) Len() int {
+	return len(c.mp)
+}
+
+// Bytes returns the memory currently used by the cache, including the
+// per-entry overhead.
+func (c *Cache) Bytes() int64 {
+	return c.nbytes
+}
+
+// Range calls fn for each entry in the order the clock hand visits them,
+// which roughly goes from the oldest to the newest, without marking them
+// recently used. Iteration stops when fn returns false.
+func (c *Cache) Range(fn func(key string, value Value) bool) {
+	for i := range c.ring {
+		e := c.ring[(c.hand+i)%len(c.ring)]
+		if e != nil && !fn(e.key, e.value) {
+			return
+		}
+	}
+}
+
+// Keys returns the keys in the cache in the order of Range.
+func (c *Cache) Keys() []string {
+	keys := make([]string, 0, len(c.mp))
+	c.Range(func(key string, value Value) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+// Resize changes the memory limit to maxBytes, 0 meaning no limit, and
+// evicts entries until the cache fits. It returns the number of entries
+// evicted.
+func (c *Cache) Resize(maxBytes int64) int {
+	c.maxBytes = maxBytes
+	n := 0
+	for c.maxBytes != 0 && c.nbytes > c.maxBytes {
+		c.RemoveOldest()
+		n++
+	}
+	return n
+}
+
+// Purge removes all entries, calling OnEvicted for each of them.
+func (c *Cache) Purge() {
+	if c.OnEvicted != nil {
+		c.Range(func(key string, value Value) bool {
+			c.OnEvicted(key, value)
+			return true
+		})
+	}
+	c.ring, c.free, c.hand = nil, nil, 0
+	c.mp = make(map[string]*entry)
+	c.nbytes = 0
+}
+
+// entrySize 估计一个条目占用的全部内存
+func entrySize(key string, value Value) int64 {
+	return lru.EntrySize(EntryOverhead, key, value)
+}
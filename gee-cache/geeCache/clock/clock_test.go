@@ -0,0 +1,226 @@
+package clock
+
+import (
+	"fmt"
+	"geeCache/lru"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+type String string
+
+func (d String) Len() int {
+	return len(d)
+}
+
+// size 返回条目在缓存中计入的大小
+func size(key, value string) int64 {
+	return entrySize(key, String(value))
+}
+
+func TestGet(t *testing.T) {
+	c := NewCache(0, nil)
+	c.Add("key1", String("1234"))
+	if v, ok := c.Get("key1"); !ok || string(v.(String)) != "1234" {
+		t.Fatalf("cache hit key1=1234 failed")
+	}
+	if _, ok := c.Get("key2"); ok {
+		t.Fatalf("cache miss key2 failed")
+	}
+}
+
+func TestSecondChance(t *testing.T) {
+	var evicted []string
+	c := NewCache(size("k1", "1")+size("k2", "2")+size("k3", "3"), func(key string, value Value) {
+		evicted = append(evicted, key)
+	})
+	c.Add("k1", String("1"))
+	c.Add("k2", String("2"))
+	c.Add("k3", String("3"))
+	// k1被访问过，指针跳过它并清除引用位，淘汰k2
+	c.Get("k1")
+	c.Add("k4", String("4"))
+	if !reflect.DeepEqual(evicted, []string{"k2"}) {
+		t.Fatalf("expect k2 evicted, got %v", evicted)
+	}
+	// Peek 不设置引用位，k3 在指针之后，先被淘汰
+	c.Peek("k3")
+	c.Add("k5", String("5"))
+	if !reflect.DeepEqual(evicted, []string{"k2", "k3"}) {
+		t.Fatalf("expect k3 evicted next, got %v", evicted)
+	}
+}
+
+func TestAddUpdate(t *testing.T) {
+	c := NewCache(0, nil)
+	c.Add("key", String("1"))
+	c.Add("key", String("111"))
+	if v, _ := c.Get("key"); v.(String) != "111" || c.Len() != 1 || c.Bytes() != size("key", "111") {
+		t.Fatalf("unexpected update: len %d bytes %d", c.Len(), c.Bytes())
+	}
+}
+
+func TestMaxEntries(t *testing.T) {
+	c := NewCache(0, nil)
+	c.MaxEntries = 2
+	c.Add("k1", String("1"))
+	c.Add("k2", String("2"))
+	c.Add("k3", String("3"))
+	if c.Contains("k1") || c.Len() != 2 {
+		t.Fatalf("expect k1 evicted by MaxEntries, got %v", c.Keys())
+	}
+}
+
+func TestRemoveAndReuse(t *testing.T) {
+	c := NewCache(0, nil)
+	c.Add("k1", String("1"))
+	c.Add("k2", String("2"))
+	if !c.Remove("k1") || c.Remove("k1") {
+		t.Fatal("Remove k1 failed")
+	}
+	c.Add("k3", String("3"))
+	if len(c.ring) != 2 {
+		t.Fatalf("expect the free slot reused, ring has %d slots", len(c.ring))
+	}
+	if c.Len() != 2 || c.Bytes() != size("k2", "2")+size("k3", "3") {
+		t.Fatalf("unexpected len %d bytes %d", c.Len(), c.Bytes())
+	}
+}
+
+func TestResizeAndPurge(t *testing.T) {
+	var evicted int
+	c := NewCache(0, func(key string, value Value) { evicted++ })
+	c.Add("k1", String("1"))
+	c.Add("k2", String("2"))
+	c.Add("k3", String("3"))
+	if n := c.Resize(size("k3", "3")); n != 2 || c.Len() != 1 {
+		t.Fatalf("expect 2 evicted, got %d, keys %v", n, c.Keys())
+	}
+	c.Purge()
+	if c.Len() != 0 || c.Bytes() != 0 || evicted != 3 {
+		t.Fatalf("expect empty cache, got len %d bytes %d evicted %d", c.Len(), c.Bytes(), evicted)
+	}
+	c.Add("k4", String("4"))
+	if !reflect.DeepEqual(c.Keys(), []string{"k4"}) {
+		t.Fatal("expect the cache usable after Purge")
+	}
+}
+
+func TestConcurrentGet(t *testing.T) {
+	c := NewCache(0, nil)
+	for i := 0; i < 100; i++ {
+		c.Add(fmt.Sprint(i), String("v"))
+	}
+	var mu sync.RWMutex
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				key := fmt.Sprint((i + j) % 100)
+				if j%10 == 0 {
+					mu.Lock()
+					c.Add(key, String("v"))
+					c.RemoveOldest()
+					mu.Unlock()
+					continue
+				}
+				mu.RLock()
+				c.Get(key)
+				mu.RUnlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+const benchKeys = 1 << 14
+
+func benchKeyList() []string {
+	keys := make([]string, benchKeys)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key%d", i)
+	}
+	return keys
+}
+
+// 与lru包比较并发读的性能：lru的Get会移动链表节点，需要互斥锁；
+// clock的Get只设置引用位，可以使用读锁
+func BenchmarkGetParallel(b *testing.B) {
+	keys := benchKeyList()
+	b.Run("lru", func(b *testing.B) {
+		c := lru.NewCache(0, nil)
+		for _, k := range keys {
+			c.Add(k, String(k))
+		}
+		var mu sync.Mutex
+		b.RunParallel(func(pb *testing.PB) {
+			i := 0
+			for pb.Next() {
+				mu.Lock()
+				c.Get(keys[i%benchKeys])
+				mu.Unlock()
+				i++
+			}
+		})
+	})
+	b.Run("clock", func(b *testing.B) {
+		c := NewCache(0, nil)
+		for _, k := range keys {
+			c.Add(k, String(k))
+		}
+		var mu sync.RWMutex
+		b.RunParallel(func(pb *testing.PB) {
+			i := 0
+			for pb.Next() {
+				mu.RLock()
+				c.Get(keys[i%benchKeys])
+				mu.RUnlock()
+				i++
+			}
+		})
+	})
+}
+
+// 读多写少的混合负载，每16次操作中有一次写入并触发淘汰
+func BenchmarkMixedParallel(b *testing.B) {
+	keys := benchKeyList()
+	limit := int64(benchKeys / 2 * 200)
+	b.Run("lru", func(b *testing.B) {
+		c := lru.NewCache(limit, nil)
+		var mu sync.Mutex
+		b.RunParallel(func(pb *testing.PB) {
+			i := 0
+			for pb.Next() {
+				k := keys[i%benchKeys]
+				mu.Lock()
+				if _, ok := c.Get(k); !ok || i%16 == 0 {
+					c.Add(k, String(k))
+				}
+				mu.Unlock()
+				i++
+			}
+		})
+	})
+	b.Run("clock", func(b *testing.B) {
+		c := NewCache(limit, nil)
+		var mu sync.RWMutex
+		b.RunParallel(func(pb *testing.PB) {
+			i := 0
+			for pb.Next() {
+				k := keys[i%benchKeys]
+				mu.RLock()
+				_, ok := c.Get(k)
+				mu.RUnlock()
+				if !ok || i%16 == 0 {
+					mu.Lock()
+					c.Add(k, String(k))
+					mu.Unlock()
+				}
+				i++
+			}
+		})
+	})
+}
@@ -61,3 +61,41 @@ func (m *Map) Get(key string) string {
 	// m.keys是一个环形结构，所以使用取余数的方式
 	return m.mp[m.keys[idx%len(m.keys)]]
 }
+
+// GetN gets up to n distinct nodes for the key, walking the ring clockwise
+// from the key's position. The first node is the one Get would return.
+func (m *Map) GetN(key string, n int) []string {
+	if len(key) == 0 || len(m.keys) == 0 || n <= 0 {
+		return nil
+	}
+	hash := int(m.hash([]byte(key)))
+	idx := sort.Search(len(m.keys), func(i int) bool {
+		return m.keys[i] >= hash
+	})
+	// 跳过属于已选中真实节点的虚拟节点，直到选够n个不同的真实节点
+	nodes := make([]string, 0, n)
+	seen := make(map[string]bool, n)
+	for i := 0; i < len(m.keys) && len(nodes) < n; i++ {
+		node := m.mp[m.keys[(idx+i)%len(m.keys)]]
+		if !seen[node] {
+			seen[node] = true
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// VirtualNode is one point on the hash ring.
+type VirtualNode struct {
+	Hash int    `json:"hash"`
+	Node string `json:"node"`
+}
+
+// Ring returns the virtual nodes sorted by hash.
+func (m *Map) Ring() []VirtualNode {
+	ring := make([]VirtualNode, len(m.keys))
+	for i, hash := range m.keys {
+		ring[i] = VirtualNode{Hash: hash, Node: m.mp[hash]}
+	}
+	return ring
+}
@@ -1,6 +1,7 @@
 package consistentHash
 
 import (
+	"reflect"
 	"strconv"
 	"testing"
 )
@@ -41,3 +42,31 @@ func TestHashing(t *testing.T) {
 	}
 
 }
+
+func TestGetN(t *testing.T) {
+	hash := New(3, func(key []byte) uint32 {
+		i, _ := strconv.Atoi(string(key))
+		return uint32(i)
+	})
+	// 2, 4, 6, 12, 14, 16, 22, 24, 26
+	hash.Add("6", "4", "2")
+
+	testCases := map[string][]string{
+		"11": {"2", "4"},
+		"23": {"4", "6"},
+		"27": {"2", "4"},
+	}
+	for k, v := range testCases {
+		if got := hash.GetN(k, 2); !reflect.DeepEqual(got, v) {
+			t.Errorf("Asking for %s, should have yielded %v, got %v", k, v, got)
+		}
+	}
+
+	// 超过真实节点数时只返回所有真实节点
+	if got := hash.GetN("11", 5); !reflect.DeepEqual(got, []string{"2", "4", "6"}) {
+		t.Errorf("expect all nodes, got %v", got)
+	}
+	if got := hash.GetN("11", 1); got[0] != hash.Get("11") {
+		t.Errorf("GetN(key, 1) should agree with Get, got %v", got)
+	}
+}
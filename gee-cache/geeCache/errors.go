@@ -0,0 +1,65 @@
+package geeCache
+
+import (
+	"errors"
+	pb "geeCache/geecachepb"
+)
+
+// ErrOverloaded is returned when a load is shed because the group already
+// runs its maximum number of concurrent loads and its wait queue is full,
+// or the load waited longer than the queue timeout. HTTPPool reports it
+// as 503 Service Unavailable.
+var ErrOverloaded = errors.New("geecache: too many concurrent loads")
+
+// ErrNotFound reports that the key does not exist in the source. Getters
+// should return an error wrapping it, e.g. fmt.Errorf("%w: %s", ErrNotFound, key),
+// so that a miss on the owner is returned as is instead of being loaded
+// again locally. HTTPPool reports it as 404 Not Found.
+var ErrNotFound = errors.New("geecache: key not found")
+
+// ErrNoSuchGroup is returned by a peer that has no group of the requested name.
+var ErrNoSuchGroup = errors.New("geecache: no such group")
+
+// peerError 是远程节点返回的错误，Unwrap 后得到对应的本地错误
+type peerError struct {
+	err error
+	msg string
+}
+
+func (e *peerError) Error() string { return e.msg }
+func (e *peerError) Unwrap() error { return e.err }
+
+// toProtoError 把错误转换为节点间协议中的错误
+func toProtoError(err error) *pb.Error {
+	code := pb.ErrorCode_UNKNOWN
+	switch {
+	case errors.Is(err, ErrNotFound):
+		code = pb.ErrorCode_NOT_FOUND
+	case errors.Is(err, ErrOverloaded):
+		code = pb.ErrorCode_OVERLOADED
+	case errors.Is(err, ErrNoSuchGroup):
+		code = pb.ErrorCode_NO_SUCH_GROUP
+	}
+	return &pb.Error{Code: code, Message: err.Error()}
+}
+
+// fromProtoError 把远程节点返回的错误还原为本地的错误类型
+func fromProtoError(e *pb.Error) error {
+	var err error
+	switch e.GetCode() {
+	case pb.ErrorCode_NOT_FOUND:
+		err = ErrNotFound
+	case pb.ErrorCode_OVERLOADED:
+		err = ErrOverloaded
+	case pb.ErrorCode_NO_SUCH_GROUP:
+		err = ErrNoSuchGroup
+	default:
+		return errors.New(e.GetMessage())
+	}
+	return &peerError{err: err, msg: e.GetMessage()}
+}
+
+// isPeerFailure 报告err是否说明节点本身出了问题；key不存在等确定的回答不算
+func isPeerFailure(err error) bool {
+	return err != nil && !errors.Is(err, ErrNotFound) && !errors.Is(err, ErrNoSuchGroup)
+}
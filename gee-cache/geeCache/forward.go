@@ -0,0 +1,69 @@
+package geeCache
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+)
+
+const (
+	// headerForwardedBy 标记请求是由其他节点转发的，值为转发节点的地址
+	headerForwardedBy = "X-Geecache-Forwarded-By"
+	// headerRingVersion 转发节点的哈希环版本，用于发现节点列表不一致
+	headerRingVersion = "X-Geecache-Ring-Version"
+)
+
+// ringVersion 根据节点列表和参数计算哈希环的版本，节点的顺序不影响结果
+func ringVersion(peers []string, replicas, replication int) string {
+	sorted := append([]string(nil), peers...)
+	sort.Strings(sorted)
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d/%d/%s", replicas, replication, strings.Join(sorted, ","))
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+type forwardedKey struct{}
+
+// withForwarded 标记ctx中的请求来自其他节点
+func withForwarded(ctx context.Context) context.Context {
+	return context.WithValue(ctx, forwardedKey{}, true)
+}
+
+// isForwarded 报告ctx中的请求是否来自其他节点，这样的请求只在本地加载，
+// 以免两个节点的哈希环不一致时互相转发
+func isForwarded(ctx context.Context) bool {
+	forwarded, _ := ctx.Value(forwardedKey{}).(bool)
+	return forwarded
+}
+
+// RingVersion returns a short hash of the peer list and ring parameters.
+// Peers that agree on the ring report the same version.
+func (p *HTTPPool) RingVersion() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.version
+}
+
+// checkRing 比较转发节点与本节点的哈希环版本，不一致时记录日志；
+// 同一个节点的同一个版本只记录一次，避免刷屏
+func (p *HTTPPool) checkRing(from, version string) {
+	p.mu.Lock()
+	mine := p.version
+	logged := version == mine || p.mismatches[from] == version
+	if !logged {
+		if p.mismatches == nil {
+			p.mismatches = make(map[string]string)
+		}
+		p.mismatches[from] = version
+	}
+	if version == mine {
+		delete(p.mismatches, from)
+	}
+	p.mu.Unlock()
+	if !logged {
+		p.logger.Warn("peer ring disagrees with ours", "self", p.self, "peer", from,
+			"peer_version", version, "version", mine)
+	}
+}
@@ -0,0 +1,50 @@
+package geeCache
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestForwardedRequestLoadsLocally(t *testing.T) {
+	var loads int32
+	gee := NewGroup("forwarded", GetterFunc(
+		func(key string) ([]byte, error) {
+			atomic.AddInt32(&loads, 1)
+			return []byte(db[key]), nil
+		}), 2<<10)
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	server := NewHTTPPoolOpts("http://b", &HTTPPoolOptions{Logger: logger})
+	server.Set("http://b")
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	// 本节点认为key属于srv，而srv上的同名group也认为key属于srv，
+	// 没有转发标记时请求会一直转发下去
+	client := NewHTTPPool("http://a")
+	client.Set("http://a", "http://b")
+	gee.RegisterPeers(fakePicker{client.newHTTPGetter(srv.URL)})
+
+	for _, key := range []string{"Tom", "Jack"} {
+		if view, err := gee.Get(key); err != nil || view.String() != db[key] {
+			t.Fatalf("expect %s, got %v %v", db[key], view, err)
+		}
+	}
+	if n := atomic.LoadInt32(&loads); n != 2 {
+		t.Fatalf("expect 2 loads on the receiving peer, got %d", n)
+	}
+	if n := strings.Count(buf.String(), "peer ring disagrees"); n != 1 {
+		t.Fatalf("expect the ring disagreement logged once, got %d in %q", n, buf.String())
+	}
+	if client.RingVersion() == server.RingVersion() {
+		t.Fatal("expect different ring versions")
+	}
+	if ringVersion([]string{"x", "y"}, 50, 1) != ringVersion([]string{"y", "x"}, 50, 1) {
+		t.Fatal("expect ring version independent of peer order")
+	}
+}
@@ -1,11 +1,13 @@
 package geeCache
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	pb "geeCache/geecachepb"
 	"geeCache/singleflight"
-	"log"
 	"sync"
+	"time"
 )
 
 // A Getter loads data for a key.
@@ -28,24 +30,170 @@ var (
 
 // Group 可以看成一个缓存的命名空间
 type Group struct {
-	name      string
-	getter    Getter // 缓存未命中时获取源数据的回调(callback)
-	mainCache cache  // 并发缓存
-	peers     PeerPicker
-	loader    *singleflight.Group // 加上 singleflight.Group，确保每个key只被请求一次
+	name        string
+	getter      Getter // 缓存未命中时获取源数据的回调(callback)
+	mainCache   cache  // 并发缓存
+	peers       PeerPicker
+	loader      *singleflight.Group // 加上 singleflight.Group，确保每个key只被请求一次
+	fwdLoader   *singleflight.Group // 其他节点转发来的请求，与loader分开以免两个节点互相等待
+	limiter     *loadLimiter        // 限制同时调用getter的数量，可以为nil
+	hedgeDelay  time.Duration       // 对冲请求的延迟，0表示不对冲
+	generations generations         // 每个key分段最近一次失效或写入的时间
+	versions    versions            // 每个key分段的版本号，用于排序节点之间的推送和失效
+	setter      Setter              // 为nil时不接受写入
+	writer      *writeBehind        // write-behind 模式下的写入队列
+	keyLocks    keyLocks            // 保证同一个key的写入顺序
+	hot         *hotKeys            // 统计每个key的访问频率
+	hotCache    *hotCache           // 本地缓存的远程热点key，可以为nil
+	tracer      Tracer
+	logger      Logger
+
+	// Stats are statistics on the group.
+	Stats Stats
+}
+
+// GroupOptions are the optional configurations of a Group.
+type GroupOptions struct {
+	// Budget is a memory budget shared with other groups. When set,
+	// cacheBytes only caps this group and may be 0 for no cap.
+	Budget *Budget
+
+	// MaxEntries caps the number of entries in the main cache, in addition
+	// to cacheBytes. If blank, only bytes are limited. The arena evictions
+	// do not support it.
+	MaxEntries int
+
+	// Eviction selects the replacement policy of the cache. If blank, it
+	// defaults to EvictLRU.
+	Eviction Eviction
+
+	// Priority weights the group when the Budget picks eviction victims
+	// across groups; a group with priority 2 keeps about twice the memory
+	// of a group with priority 1. If blank, it defaults to 1.
+	Priority int
+
+	// MaxConcurrentLoads limits how many calls to the Getter may run at
+	// once. If blank, loads are not limited.
+	MaxConcurrentLoads int
+
+	// MaxLoadQueue is how many loads may wait for a free slot once
+	// MaxConcurrentLoads is reached; further loads fail with ErrOverloaded.
+	MaxLoadQueue int
+
+	// LoadQueueTimeout is how long a load may wait in the queue before it
+	// fails with ErrOverloaded. If blank, queued loads wait indefinitely.
+	LoadQueueTimeout time.Duration
+
+	// HedgeDelay, if set, makes a load that has not been answered by the
+	// owner within the delay also ask the next replica, or the local
+	// Getter when there is none. The first success wins and the other
+	// request is cancelled.
+	HedgeDelay time.Duration
+
+	// Tracer receives a span for every Get and every peer selection.
+	// If blank, spans are not recorded.
+	Tracer Tracer
+
+	// Setter, if set, lets Set write values through to the origin.
+	Setter Setter
+
+	// WriteMode selects write-through or write-behind for Set.
+	// If blank, it defaults to WriteThrough.
+	WriteMode WriteMode
+
+	// WriteBatchSize is the largest batch a write-behind queue flushes
+	// at once. If blank, it defaults to 100.
+	WriteBatchSize int
+
+	// WriteDelay is how long a write-behind queue waits for more writes
+	// before flushing a batch. If blank, it defaults to 100ms.
+	WriteDelay time.Duration
+
+	// WriteRetries is how many times a failed write-behind batch is
+	// retried before its entries are dropped. If blank, it defaults to 3.
+	WriteRetries int
+
+	// MaxWriteQueue is how many distinct keys may wait in the write-behind
+	// queue; further writes fail with ErrOverloaded. If blank, it
+	// defaults to 10000.
+	MaxWriteQueue int
+
+	// HotKeyTopK is how many of the most requested keys are tracked and
+	// reported by HotKeys. If blank, it defaults to 10.
+	HotKeyTopK int
+
+	// HotKeyThreshold is the estimated number of recent requests from
+	// which a key counts as hot. If blank, it defaults to 100.
+	HotKeyThreshold int
+
+	// HotCacheTTL is how long a hot key loaded from its remote owner is
+	// served from a local copy, which may be stale for that long.
+	// If blank, hot keys are not copied locally.
+	HotCacheTTL time.Duration
+
+	// HotCacheBytes caps the memory of the local copies of hot keys.
+	// If blank, it defaults to 1MB.
+	HotCacheBytes int64
+
+	// Logger receives the group's logs, with cache hits at debug level.
+	// If blank, only warnings and errors are written to stderr.
+	Logger Logger
 }
 
 func NewGroup(name string, getter Getter, cacheBytes int64) *Group {
+	return NewGroupOpts(name, getter, cacheBytes, nil)
+}
+
+// NewGroupOpts creates a Group with the given options.
+func NewGroupOpts(name string, getter Getter, cacheBytes int64, o *GroupOptions) *Group {
 	if getter == nil {
 		panic("nil Getter")
 	}
+	var opts GroupOptions
+	if o != nil {
+		opts = *o
+	}
+	if opts.Priority <= 0 {
+		opts.Priority = 1
+	}
+	if opts.Tracer == nil {
+		opts.Tracer = nopTracer{}
+	}
+	if opts.Logger == nil {
+		opts.Logger = defaultLogger
+	}
+	if opts.HotKeyTopK <= 0 {
+		opts.HotKeyTopK = defaultHotKeyTopK
+	}
+	if opts.HotKeyThreshold <= 0 {
+		opts.HotKeyThreshold = defaultHotKeyThreshold
+	}
+	if opts.HotCacheBytes <= 0 {
+		opts.HotCacheBytes = defaultHotCacheBytes
+	}
 	mu.Lock()
 	defer mu.Unlock()
 	g := &Group{
-		name:      name,
-		getter:    getter,
-		mainCache: cache{cacheBytes: cacheBytes},
-		loader:    &singleflight.Group{},
+		name:       name,
+		getter:     getter,
+		mainCache:  cache{cacheBytes: cacheBytes, maxEntries: opts.MaxEntries, eviction: opts.Eviction, budget: opts.Budget},
+		loader:     &singleflight.Group{},
+		fwdLoader:  &singleflight.Group{},
+		limiter:    newLoadLimiter(opts.MaxConcurrentLoads, opts.MaxLoadQueue, opts.LoadQueueTimeout),
+		hedgeDelay: opts.HedgeDelay,
+		tracer:     opts.Tracer,
+		logger:     opts.Logger,
+		setter:     opts.Setter,
+		hot:        newHotKeys(opts.HotKeyTopK, opts.HotKeyThreshold),
+	}
+	if opts.HotCacheTTL > 0 {
+		g.hotCache = &hotCache{maxBytes: opts.HotCacheBytes, ttl: opts.HotCacheTTL}
+	}
+	if opts.Setter != nil && opts.WriteMode == WriteBehind {
+		g.writer = newWriteBehind(g, opts.Setter, &opts)
+	}
+	if opts.Budget != nil {
+		opts.Budget.register(&g.mainCache, opts.Priority)
 	}
 	groups[name] = g
 	return g
@@ -58,17 +206,140 @@ func GetGroup(name string) *Group {
 	return g
 }
 
+// UnregisterGroup removes the named group from the registry, drops its
+// cache and returns its memory to the budget. It reports whether the
+// group existed.
+func UnregisterGroup(name string) bool {
+	mu.Lock()
+	g := groups[name]
+	delete(groups, name)
+	mu.Unlock()
+	if g == nil {
+		return false
+	}
+	g.release()
+	return true
+}
+
+// Close removes the group from the registry and frees its memory,
+// after flushing its write-behind queue. The group must not be used
+// afterwards.
+func (g *Group) Close() {
+	mu.Lock()
+	// 同名的group可能已经被新的NewGroup替换，此时只释放自己
+	if groups[g.name] == g {
+		delete(groups, g.name)
+	}
+	mu.Unlock()
+	g.release()
+}
+
+func (g *Group) release() {
+	if g.writer != nil {
+		g.writer.close()
+	}
+	g.mainCache.release()
+	g.hotCache.purge()
+}
+
+// allGroups 返回当前注册的所有group
+func allGroups() []*Group {
+	mu.RLock()
+	defer mu.RUnlock()
+	gs := make([]*Group, 0, len(groups))
+	for _, g := range groups {
+		gs = append(gs, g)
+	}
+	return gs
+}
+
+// Name returns the name of the group.
+func (g *Group) Name() string {
+	return g.name
+}
+
+// CacheStats returns stats about the group's cache.
+func (g *Group) CacheStats() CacheStats {
+	return g.mainCache.stats()
+}
+
 func (g *Group) Get(key string) (ByteView, error) {
+	return g.GetContext(context.Background(), key)
+}
+
+// GetContext is like Get, but cancelling ctx abandons requests to peers.
+func (g *Group) GetContext(ctx context.Context, key string) (value ByteView, err error) {
+	ctx, span := g.tracer.Start(ctx, "geecache.Group.Get", Attr("group", g.name), Attr("key", key))
+	defer func() { span.End(err) }()
+	g.Stats.Gets.Add(1)
 	if key == "" {
 		return ByteView{}, fmt.Errorf("key is required")
 	}
+	g.hot.observe(key)
 	// 流程（1）：从 mainCache 中查找缓存，如果存在则返回缓存值。
 	if v, ok := g.mainCache.get(key); ok {
-		log.Println("[GeeCache] hit")
+		g.Stats.CacheHits.Add(1)
+		span.SetAttributes(Attr("cache_hit", true))
+		g.logger.Debug("cache hit", "group", g.name, "key", key)
 		return v, nil
 	}
+	// 流程（2）：远程节点的热点key可能在本地有一份短暂的副本
+	if v, ok := g.hotCache.get(key, time.Now()); ok {
+		g.Stats.HotCacheHits.Add(1)
+		span.SetAttributes(Attr("cache_hit", true), Attr("hot", true))
+		g.logger.Debug("hot cache hit", "group", g.name, "key", key)
+		return v, nil
+	}
+	span.SetAttributes(Attr("cache_hit", false))
 	// 流程（3）：缓存不存在，则调用 load 方法
-	return g.load(key)
+	return g.load(ctx, key)
+}
+
+// Cached reports whether key is held in the local cache, without counting
+// as a get or updating the key's recency.
+func (g *Group) Cached(key string) bool {
+	return g.mainCache.contains(key)
+}
+
+// Resize changes the memory limit of the local cache to cacheBytes and
+// evicts the least recently used entries until it fits. It returns the
+// number of entries evicted. With a Budget, 0 removes the group's own
+// limit.
+func (g *Group) Resize(cacheBytes int64) int {
+	return g.mainCache.resize(cacheBytes)
+}
+
+// Evict removes key from the local cache. Copies on other peers are kept.
+func (g *Group) Evict(key string) bool {
+	g.hotCache.remove(key)
+	return g.mainCache.remove(key)
+}
+
+// EvictPrefix removes every key starting with prefix from the local cache
+// and returns how many were removed.
+func (g *Group) EvictPrefix(prefix string) int {
+	g.hotCache.removePrefix(prefix)
+	return g.mainCache.removePrefix(prefix)
+}
+
+// invalidate 处理失效事件：先让进行中的加载不再写入缓存，再删除数据
+func (g *Group) invalidate(key string, prefix bool) int {
+	g.Stats.Invalidations.Add(1)
+	if prefix {
+		g.generations.bumpAll()
+		return g.EvictPrefix(key)
+	}
+	g.generations.bump(key)
+	if g.Evict(key) {
+		return 1
+	}
+	return 0
+}
+
+// Purge drops every entry from the local cache and returns how many were dropped.
+func (g *Group) Purge() int {
+	g.hotCache.purge()
+	return g.mainCache.purge()
 }
 
 // RegisterPeers 将实现了PeerPicker接口的HTTPPool注入到Group中
@@ -80,37 +351,172 @@ func (g *Group) RegisterPeers(peers PeerPicker) {
 	g.peers = peers
 }
 
-func (g *Group) load(key string) (value ByteView, err error) {
-	// 每个key只会被请求一次
-	view, err := g.loader.Do(key, func() (interface{}, error) {
-		if g.peers != nil {
-			// 使用PickPeer() 选择节点，若为ok则说明选择的节点为远程节点
-			if peer, ok := g.peers.PickPeer(key); ok {
-				// 调用getFromPeer获取缓存值
-				if value, err := g.getFromPeer(peer, key); err == nil {
-					return value, nil
-				}
-				log.Println("[GeeCache] Failed to get from peer", err)
+func (g *Group) load(ctx context.Context, key string) (value ByteView, err error) {
+	g.Stats.Loads.Add(1)
+	// 其他节点转发来的请求只在本地加载：即使两个节点的哈希环不一致，
+	// 请求最多也只会被转发一次
+	if isForwarded(ctx) {
+		view, err := g.fwdLoader.Do(key, func() (interface{}, error) {
+			g.Stats.LoadsDeduped.Add(1)
+			version := g.versions.load(key)
+			value, err := g.getLocally(key)
+			if err == nil && g.peers != nil {
+				// 转发来的请求说明本节点是owner之一，同样要把值推送给其他副本
+				g.pushToReplicas(g.owners(ctx, key), key, value, version)
 			}
+			return value, err
+		})
+		if err != nil {
+			return ByteView{}, err
 		}
-		// !ok,说明选择远程节点失败或者选择的是本地节点
-		return g.getLocally(key)
+		return view.(ByteView), nil
+	}
+	// 每个key只会被请求一次。加载由所有等待的调用方共享，不随其中任何一个
+	// 调用方取消，调用方各自在ctx结束时放弃等待
+	loadCtx := context.WithoutCancel(ctx)
+	ch := g.loader.DoChan(key, func() (interface{}, error) {
+		return g.loadShared(loadCtx, key)
 	})
+	select {
+	case r := <-ch:
+		// getter在共享的加载中panic，在调用方的goroutine上重新panic，
+		// 与在调用方直接加载时的行为一致
+		if p, ok := r.Err.(*singleflight.PanicError); ok {
+			panic(p)
+		}
+		if r.Err != nil {
+			return ByteView{}, r.Err
+		}
+		return r.Val.(ByteView), nil
+	case <-ctx.Done():
+		return ByteView{}, ctx.Err()
+	}
+}
 
-	if err == nil {
-		return view.(ByteView), nil
+// loadShared 按环上的顺序依次尝试key的各个副本节点，都失败时在本地加载
+func (g *Group) loadShared(ctx context.Context, key string) (ByteView, error) {
+	g.Stats.LoadsDeduped.Add(1)
+	gen, version := g.generations.load(key), g.versions.load(key)
+	// nil代表本节点
+	owners := g.owners(ctx, key)
+	triedLocal := false
+	var lastErr error
+	for i := 0; i < len(owners); i++ {
+		peer := owners[i]
+		if peer == nil {
+			value, err := g.getLocally(key)
+			if err == nil {
+				// 本节点是owner之一，把新加载的值异步推送给其他副本
+				g.pushToReplicas(owners, key, value, version)
+			}
+			return value, err
+		}
+		var r hedgeResult
+		local := false
+		if g.hedgeDelay > 0 {
+			// owner迟迟没有响应时，向下一个副本(或本地getter)发起对冲请求
+			var backup PeerGetter
+			if i+1 < len(owners) {
+				backup = owners[i+1]
+			}
+			var hedged bool
+			r, hedged = g.hedgedGet(ctx, peer, backup, key)
+			if hedged {
+				// 对冲的副本已经尝试过，下一轮跳过它；本地getter也不再重复加载
+				i++
+				triedLocal = triedLocal || backup == nil
+			}
+			local = r.hedge && backup == nil
+		} else {
+			// 调用getFromPeer获取缓存值
+			r.value, r.err = g.getFromPeer(ctx, peer, key)
+		}
+		if r.err == nil && local {
+			// 本地getter赢得了对冲，值已经写入本地缓存
+			return r.value, nil
+		}
+		if r.err == nil {
+			g.Stats.PeerLoads.Add(1)
+			// 热点key在本地保留一份短暂的副本，加载期间收到失效事件时除外
+			if g.hotCache != nil && g.hot.isHot(key) && g.generations.load(key) == gen {
+				g.hotCache.add(key, r.value, time.Now())
+			}
+			return r.value, nil
+		}
+		// owner过载时不在本地重试，否则同样会把压力转移到数据源上；
+		// owner确认key不存在时，本地加载也只会得到同样的结果
+		if errors.Is(r.err, ErrOverloaded) || errors.Is(r.err, ErrNotFound) {
+			return ByteView{}, r.err
+		}
+		g.Stats.PeerErrors.Add(1)
+		if errors.Is(r.err, ErrCircuitOpen) {
+			// 断路器打开期间每个请求都会走到这里，状态变化时已经记录过
+			g.logger.Debug("skipped peer with an open breaker", "group", g.name, "key", key)
+		} else {
+			g.logger.Warn("failed to get from peer", "group", g.name, "key", key, "err", r.err)
+		}
+		lastErr = r.err
+	}
+	if triedLocal {
+		return ByteView{}, lastErr
+	}
+	// 所有远程副本都失败了，回退到本地加载
+	return g.getLocally(key)
+}
+
+// owners 返回key的所有副本节点，nil代表本节点
+func (g *Group) owners(ctx context.Context, key string) (owners []PeerGetter) {
+	_, span := g.tracer.Start(ctx, "geecache.PickPeer", Attr("group", g.name), Attr("key", key))
+	defer func() {
+		local := false
+		for _, peer := range owners {
+			local = local || peer == nil
+		}
+		span.SetAttributes(Attr("owners", len(owners)), Attr("local", local))
+		span.End(nil)
+	}()
+	if g.peers == nil {
+		return []PeerGetter{nil}
+	}
+	if rp, ok := g.peers.(ReplicaPicker); ok {
+		return rp.PickPeers(key)
+	}
+	// 使用PickPeer() 选择节点，若为ok则说明选择的节点为远程节点
+	if peer, ok := g.peers.PickPeer(key); ok {
+		return []PeerGetter{peer}
+	}
+	return []PeerGetter{nil}
+}
+
+// pushToReplicas 异步地把value推送给除本节点外的其他副本，version 是开始加载时key的版本号
+func (g *Group) pushToReplicas(owners []PeerGetter, key string, value ByteView, version int64) {
+	for _, peer := range owners {
+		pusher, ok := peer.(PeerPusher)
+		if !ok {
+			continue
+		}
+		go func() {
+			req := &pb.Request{Group: g.name, Key: key}
+			if err := pusher.Push(req, value.bytes(), version); err != nil {
+				g.logger.Warn("failed to push to replica", "group", g.name, "key", key, "err", err)
+			}
+		}()
 	}
-	return
 }
 
 // getFromPeer 使用实现了PeerGetter接口的httpGetter访问远程节点，获取缓存值
-func (g *Group) getFromPeer(peer PeerGetter, key string) (ByteView, error) {
+func (g *Group) getFromPeer(ctx context.Context, peer PeerGetter, key string) (ByteView, error) {
 	req := &pb.Request{
 		Group: g.name,
 		Key:   key,
 	}
 	res := &pb.Response{}
-	err := peer.Get(req, res)
+	var err error
+	if cp, ok := peer.(ContextPeerGetter); ok {
+		err = cp.GetContext(ctx, req, res)
+	} else {
+		err = peer.Get(req, res)
+	}
 	if err != nil {
 		return ByteView{}, err
 	}
@@ -118,14 +524,35 @@ func (g *Group) getFromPeer(peer PeerGetter, key string) (ByteView, error) {
 }
 
 func (g *Group) getLocally(key string) (ByteView, error) {
+	gen := g.generations.load(key)
+	// write-behind 模式下还没写入数据源的值比数据源中的新，缓存被淘汰后
+	// 不能从数据源读到旧值
+	if value, ok := g.writer.lookup(key); ok {
+		view := ByteView{b: value}
+		if g.generations.load(key) == gen {
+			g.populateCache(key, view)
+		}
+		return view, nil
+	}
+	if err := g.limiter.acquire(); err != nil {
+		g.Stats.LoadsShed.Add(1)
+		return ByteView{}, err
+	}
+	// getter panic时也要归还名额
+	defer g.limiter.release()
 	// 调用用户回调函数 g.getter.Get() 获取源数据
 	bytes, err := g.getter.Get(key)
 	if err != nil {
+		g.Stats.LocalLoadErrs.Add(1)
 		return ByteView{}, err
 	}
-	value := ByteView{b: cloneBytes(bytes)}
-	// 并且将源数据添加到缓存 mainCache 中
-	g.populateCache(key, value)
+	g.Stats.LocalLoads.Add(1)
+	value := NewByteView(bytes)
+	// 并且将源数据添加到缓存 mainCache 中；
+	// 加载期间收到了失效事件时，加载到的值可能已经过期，不写入缓存
+	if g.generations.load(key) == gen {
+		g.populateCache(key, value)
+	}
 	return value, nil
 }
 
@@ -1,10 +1,16 @@
 package geeCache
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	pb "geeCache/geecachepb"
+	"geeCache/singleflight"
 	"log"
 	"reflect"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 var db = map[string]string{
@@ -65,3 +71,440 @@ func TestGetGroup(t *testing.T) {
 		t.Fatalf("expect nil, but %s got", group.name)
 	}
 }
+
+type fakePeer struct {
+	value  string
+	err    error
+	pushed chan string
+}
+
+func (p *fakePeer) Get(in *pb.Request, out *pb.Response) error {
+	if p.err != nil {
+		return p.err
+	}
+	out.Value = []byte(p.value)
+	return nil
+}
+
+func (p *fakePeer) Push(in *pb.Request, value []byte, version int64) error {
+	p.pushed <- in.GetKey() + "=" + string(value)
+	return nil
+}
+
+type fakePicker []PeerGetter
+
+func (p fakePicker) PickPeer(key string) (PeerGetter, bool) {
+	if p[0] == nil {
+		return nil, false
+	}
+	return p[0], true
+}
+
+func (p fakePicker) PickPeers(key string) []PeerGetter {
+	return p
+}
+
+func TestLoadFromReplica(t *testing.T) {
+	gee := NewGroup("replicas", GetterFunc(
+		func(key string) ([]byte, error) {
+			t.Fatalf("unexpected local load of %s", key)
+			return nil, nil
+		}), 2<<10)
+	gee.RegisterPeers(fakePicker{
+		&fakePeer{err: fmt.Errorf("owner down")},
+		&fakePeer{value: "630"},
+	})
+	if view, err := gee.Get("Tom"); err != nil || view.String() != "630" {
+		t.Fatalf("expect 630 from replica, got %v %v", view, err)
+	}
+}
+
+func TestPushToReplicas(t *testing.T) {
+	// 其他节点转发来的请求在本地加载后同样要推送给副本
+	for name, ctx := range map[string]context.Context{
+		"direct":    context.Background(),
+		"forwarded": withForwarded(context.Background()),
+	} {
+		gee := NewGroup("owner-"+name, GetterFunc(
+			func(key string) ([]byte, error) {
+				return []byte(db[key]), nil
+			}), 2<<10)
+		replica := &fakePeer{pushed: make(chan string, 1)}
+		gee.RegisterPeers(fakePicker{nil, replica})
+		if view, err := gee.GetContext(ctx, "Tom"); err != nil || view.String() != "630" {
+			t.Fatalf("%s: expect 630, got %v %v", name, view, err)
+		}
+		select {
+		case got := <-replica.pushed:
+			if got != "Tom=630" {
+				t.Fatalf("%s: expect Tom=630 pushed, got %s", name, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s: value was not pushed to replica", name)
+		}
+	}
+}
+
+func TestBudget(t *testing.T) {
+	// 每个条目还有约200字节的额外开销
+	budget := NewBudget(10000)
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return make([]byte, 10), nil
+	})
+	low := NewGroupOpts("budget-low", getter, 0, &GroupOptions{Budget: budget})
+	high := NewGroupOpts("budget-high", getter, 0, &GroupOptions{Budget: budget, Priority: 3})
+
+	for i := 0; i < 100; i++ {
+		low.Get(fmt.Sprintf("key%02d", i))
+		high.Get(fmt.Sprintf("key%02d", i))
+	}
+	if total := budget.Bytes(); total > 10000 {
+		t.Fatalf("budget exceeded: %d bytes used", total)
+	}
+	lowBytes, highBytes := low.CacheStats().Bytes, high.CacheStats().Bytes
+	if highBytes < 2*lowBytes {
+		t.Fatalf("expect high priority group to keep ~3x memory, got low=%d high=%d", lowBytes, highBytes)
+	}
+
+	// 关闭一个group后，其内存归还给预算，另一个group可以使用
+	high.Close()
+	if GetGroup("budget-high") != nil {
+		t.Fatal("closed group is still registered")
+	}
+	for i := 0; i < 100; i++ {
+		low.Get(fmt.Sprintf("key%02d", i))
+	}
+	if lowBytes := low.CacheStats().Bytes; lowBytes < 9000 {
+		t.Fatalf("expect low group to use the freed budget, got %d", lowBytes)
+	}
+
+	if !UnregisterGroup("budget-low") || UnregisterGroup("budget-low") {
+		t.Fatal("UnregisterGroup should succeed exactly once")
+	}
+	if budget.Bytes() != 0 {
+		t.Fatalf("expect budget released, got %d", budget.Bytes())
+	}
+	// 仍持有已注销group的调用方写入的数据不再计入预算
+	low.Get("late")
+	if budget.Bytes() != 0 {
+		t.Fatalf("expect a released group not to charge the budget, got %d", budget.Bytes())
+	}
+}
+
+func TestBudgetTracksRemovals(t *testing.T) {
+	budget := NewBudget(1 << 20)
+	gee := NewGroupOpts("budget-removals", GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(db[key]), nil
+		}), 0, &GroupOptions{Budget: budget})
+	defer gee.Close()
+
+	for k := range db {
+		gee.Get(k)
+	}
+	check := func(step string) {
+		if used, cached := budget.Bytes(), gee.CacheStats().Bytes; used != cached {
+			t.Fatalf("%s: budget counts %d bytes, cache uses %d", step, used, cached)
+		}
+	}
+	check("add")
+	gee.Evict("Tom")
+	check("evict")
+	gee.EvictPrefix("J")
+	check("evict prefix")
+	gee.Resize(1)
+	check("resize")
+	gee.Get("Sam")
+	gee.Purge()
+	check("purge")
+	if budget.Bytes() != 0 {
+		t.Fatalf("expect nothing charged after purge, got %d", budget.Bytes())
+	}
+}
+
+func TestLoadLimit(t *testing.T) {
+	release := make(chan struct{})
+	gee := NewGroupOpts("limited", GetterFunc(
+		func(key string) ([]byte, error) {
+			<-release
+			return []byte(key), nil
+		}), 2<<10, &GroupOptions{
+		MaxConcurrentLoads: 1,
+		MaxLoadQueue:       1,
+		LoadQueueTimeout:   50 * time.Millisecond,
+	})
+
+	running := make(chan error, 1)
+	go func() {
+		_, err := gee.Get("running")
+		running <- err
+	}()
+	for len(gee.limiter.slots) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	queued := make(chan error, 1)
+	go func() {
+		_, err := gee.Get("queued")
+		queued <- err
+	}()
+	for atomic.LoadInt64(&gee.limiter.waiting) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// 队列已满，立即被拒绝
+	if _, err := gee.Get("rejected"); err != ErrOverloaded {
+		t.Fatalf("expect ErrOverloaded when the queue is full, got %v", err)
+	}
+	// 排队超时
+	if err := <-queued; err != ErrOverloaded {
+		t.Fatalf("expect ErrOverloaded after the queue timeout, got %v", err)
+	}
+	close(release)
+	if err := <-running; err != nil {
+		t.Fatal(err)
+	}
+	if shed := gee.Stats.LoadsShed.Get(); shed != 2 {
+		t.Fatalf("expect 2 loads shed, got %d", shed)
+	}
+	if _, err := gee.Get("after"); err != nil {
+		t.Fatalf("expect load to succeed once the slot is free, got %v", err)
+	}
+}
+
+func TestLoadLimitReleasedOnPanic(t *testing.T) {
+	gee := NewGroupOpts("limited-panic", GetterFunc(
+		func(key string) ([]byte, error) {
+			panic("getter failed")
+		}), 2<<10, &GroupOptions{MaxConcurrentLoads: 1})
+
+	func() {
+		defer func() { recover() }()
+		gee.getLocally("Tom")
+	}()
+	if n := len(gee.limiter.slots); n != 0 {
+		t.Fatalf("expect the load slot released after a panic, %d still held", n)
+	}
+}
+
+// slowPeer 在ctx被取消或者delay之后才返回
+type slowPeer struct {
+	value     string
+	delay     time.Duration
+	cancelled chan struct{}
+}
+
+func (p *slowPeer) Get(in *pb.Request, out *pb.Response) error {
+	return p.GetContext(context.Background(), in, out)
+}
+
+func (p *slowPeer) GetContext(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	select {
+	case <-time.After(p.delay):
+		out.Value = []byte(p.value)
+		return nil
+	case <-ctx.Done():
+		close(p.cancelled)
+		return ctx.Err()
+	}
+}
+
+func TestHedgedGet(t *testing.T) {
+	owner := &slowPeer{value: "owner", delay: time.Second, cancelled: make(chan struct{})}
+	gee := NewGroupOpts("hedged", GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("unexpected local load of %s", key)
+		}), 2<<10, &GroupOptions{HedgeDelay: 10 * time.Millisecond})
+	gee.RegisterPeers(fakePicker{owner, &fakePeer{value: "replica"}})
+
+	if view, err := gee.Get("Tom"); err != nil || view.String() != "replica" {
+		t.Fatalf("expect the hedge to win, got %v %v", view, err)
+	}
+	select {
+	case <-owner.cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("the slow owner request was not cancelled")
+	}
+	if fired, won := gee.Stats.HedgesFired.Get(), gee.Stats.HedgesWon.Get(); fired != 1 || won != 1 {
+		t.Fatalf("expect 1 hedge fired and won, got %d/%d", fired, won)
+	}
+}
+
+func TestHedgeNotFoundNotWon(t *testing.T) {
+	owner := &slowPeer{value: "owner", delay: time.Second, cancelled: make(chan struct{})}
+	gee := NewGroupOpts("hedged-not-found", GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("unexpected local load of %s", key)
+		}), 2<<10, &GroupOptions{HedgeDelay: 10 * time.Millisecond})
+	gee.RegisterPeers(fakePicker{owner, &fakePeer{err: ErrNotFound}})
+
+	// 对冲请求先返回key不存在，结束等待但不算赢
+	if _, err := gee.Get("Tom"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expect ErrNotFound from the hedge, got %v", err)
+	}
+	if fired, won := gee.Stats.HedgesFired.Get(), gee.Stats.HedgesWon.Get(); fired != 1 || won != 0 {
+		t.Fatalf("expect 1 hedge fired and none won, got %d/%d", fired, won)
+	}
+}
+
+func TestHedgeToLocalGetter(t *testing.T) {
+	gee := NewGroupOpts("hedged-local", GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("local"), nil
+		}), 2<<10, &GroupOptions{HedgeDelay: 10 * time.Millisecond})
+	fast := &slowPeer{value: "owner", delay: time.Millisecond}
+	gee.RegisterPeers(fakePicker{fast})
+
+	// owner在对冲延迟之前返回，不发起对冲
+	if view, err := gee.Get("Tom"); err != nil || view.String() != "owner" {
+		t.Fatalf("expect the owner to answer, got %v %v", view, err)
+	}
+	if fired := gee.Stats.HedgesFired.Get(); fired != 0 {
+		t.Fatalf("expect no hedge, got %d", fired)
+	}
+
+	fast.delay, fast.cancelled = time.Second, make(chan struct{})
+	if view, err := gee.Get("Jack"); err != nil || view.String() != "local" {
+		t.Fatalf("expect the local getter to win, got %v %v", view, err)
+	}
+	if won := gee.Stats.HedgesWon.Get(); won != 1 {
+		t.Fatalf("expect 1 hedge won, got %d", won)
+	}
+	// 本地赢得的对冲不算作从peer加载
+	if s := gee.Stats.Snapshot(); s.PeerLoads != 1 || s.LocalLoads != 1 {
+		t.Fatalf("expect 1 peer load and 1 local load, got %+v", s)
+	}
+}
+
+// failingPeer 在delay之后返回错误，并记录收到的请求数
+type failingPeer struct {
+	delay time.Duration
+	gets  int32
+}
+
+func (p *failingPeer) Get(in *pb.Request, out *pb.Response) error {
+	atomic.AddInt32(&p.gets, 1)
+	time.Sleep(p.delay)
+	return errors.New("peer failed")
+}
+
+func TestHedgeSkipsFailedBackup(t *testing.T) {
+	gee := NewGroupOpts("hedged-failed", GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("unexpected local load of %s", key)
+		}), 2<<10, &GroupOptions{HedgeDelay: 10 * time.Millisecond, Logger: DiscardLogger})
+	owner, backup, third := &failingPeer{delay: 50 * time.Millisecond}, &failingPeer{}, &countingPeer{}
+	gee.RegisterPeers(fakePicker{owner, backup, third})
+
+	// owner和对冲的backup都失败后，直接尝试第三个副本，不再重试backup
+	if view, err := gee.Get("Tom"); err != nil || view.String() != "630" {
+		t.Fatalf("expect the third replica to answer, got %v %v", view, err)
+	}
+	if atomic.LoadInt32(&backup.gets) != 1 || atomic.LoadInt32(&third.gets) != 1 {
+		t.Fatalf("expect one request to backup and third, got %d and %d", backup.gets, third.gets)
+	}
+	if won := gee.Stats.HedgesWon.Get(); won != 0 {
+		t.Fatalf("expect no hedge won, got %d", won)
+	}
+}
+
+func TestHedgeToFailingLocalGetter(t *testing.T) {
+	var loads int32
+	gee := NewGroupOpts("hedged-local-failed", GetterFunc(
+		func(key string) ([]byte, error) {
+			atomic.AddInt32(&loads, 1)
+			return nil, errors.New("origin failed")
+		}), 2<<10, &GroupOptions{HedgeDelay: 10 * time.Millisecond, Logger: DiscardLogger})
+	gee.RegisterPeers(fakePicker{&failingPeer{delay: 50 * time.Millisecond}})
+
+	// 本地getter作为对冲请求已经失败过，所有副本失败后不再回退到本地加载
+	if _, err := gee.Get("Tom"); err == nil {
+		t.Fatal("expect an error when every source failed")
+	}
+	if n := atomic.LoadInt32(&loads); n != 1 {
+		t.Fatalf("expect the local getter called once, got %d", n)
+	}
+}
+
+func TestHedgePanic(t *testing.T) {
+	owner := &slowPeer{value: "owner", delay: time.Second, cancelled: make(chan struct{})}
+	gee := NewGroupOpts("hedged-panic", GetterFunc(
+		func(key string) ([]byte, error) {
+			panic("boom")
+		}), 2<<10, &GroupOptions{HedgeDelay: 10 * time.Millisecond})
+	gee.RegisterPeers(fakePicker{owner})
+
+	// 对冲的本地加载panic时，panic出现在调用Get的goroutine上
+	defer func() {
+		if p, ok := recover().(*singleflight.PanicError); !ok || p.Value != "boom" {
+			t.Fatalf("expect the getter's panic on the caller, got %v", p)
+		}
+	}()
+	gee.Get("Tom")
+}
+
+func TestLoadDetachedFromCaller(t *testing.T) {
+	owner := &slowPeer{value: "owner", delay: 100 * time.Millisecond, cancelled: make(chan struct{})}
+	gee := NewGroupOpts("detached", GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("unexpected local load of %s", key)
+		}), 2<<10, nil)
+	gee.RegisterPeers(fakePicker{owner})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := gee.GetContext(ctx, "Tom")
+		first <- err
+	}()
+	for gee.loader.InFlight() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	second := make(chan string, 1)
+	go func() {
+		view, _ := gee.Get("Tom")
+		second <- view.String()
+	}()
+	// 第一个调用方放弃等待，不影响共享的加载
+	cancel()
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expect the cancelled caller to return, got %v", err)
+	}
+	if v := <-second; v != "owner" {
+		t.Fatalf("expect the other caller to get the value, got %q", v)
+	}
+	select {
+	case <-owner.cancelled:
+		t.Fatal("the shared load was cancelled with the first caller")
+	default:
+	}
+}
+
+// Group.Get 命中时的并发性能，包括热点统计、指标和本地缓存的开销
+func BenchmarkGroupGetParallel(b *testing.B) {
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key%d", i)
+	}
+	for _, eviction := range []struct {
+		name string
+		e    Eviction
+	}{{"lru", EvictLRU}, {"clock", EvictClock}, {"arena", EvictArenaLRU}} {
+		b.Run(eviction.name, func(b *testing.B) {
+			gee := NewGroupOpts("bench-"+eviction.name, GetterFunc(
+				func(key string) ([]byte, error) {
+					return []byte(key), nil
+				}), 2<<20, &GroupOptions{Eviction: eviction.e})
+			for _, k := range keys {
+				gee.Get(k)
+			}
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					gee.Get(keys[i%len(keys)])
+					i++
+				}
+			})
+		})
+	}
+}
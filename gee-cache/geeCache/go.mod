@@ -1,8 +1,5 @@
 module geeCache
 
-go 1.17
+go 1.21
 
-require (
-	github.com/golang/protobuf v1.5.2
-	google.golang.org/protobuf v1.28.0
-)
+require google.golang.org/protobuf v1.28.0
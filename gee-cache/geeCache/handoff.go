@@ -0,0 +1,207 @@
+package geeCache
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"geeCache/consistentHash"
+	pb "geeCache/geecachepb"
+	"google.golang.org/protobuf/proto"
+	"io/ioutil"
+	"net/http"
+)
+
+const (
+	handoffPath        = "_handoff"
+	defaultHandoffRate = 1000 // 每秒交接的条目数
+	handoffBatchSize   = 100  // 每个请求携带的条目数
+)
+
+// rebalance 在节点列表变化后交接数据。多次Set触发的交接依次执行，每次都从
+// 上一次交接到的环交接到当前的环，执行顺序与Set的顺序不同也不会交接到过时的环
+func (p *HTTPPool) rebalance() {
+	p.handoffMu.Lock()
+	defer p.handoffMu.Unlock()
+	p.mu.Lock()
+	oldRing, newRing, getters := p.handedOff, p.peers, p.httpGetters
+	if len(getters) == 0 || oldRing == newRing {
+		p.mu.Unlock()
+		return
+	}
+	p.handedOff = newRing
+	p.mu.Unlock()
+	p.handoff(context.Background(), oldRing, newRing, getters)
+}
+
+// handoff 把本节点在旧的环上持有的缓存条目交给新的环上新增的副本节点，
+// 以免新owner冷启动时把请求全部打到数据源上。同一个key的多个旧副本中，
+// 只由仍在新的环上的第一个旧副本交接，都不在时由旧的owner交接
+func (p *HTTPPool) handoff(ctx context.Context, oldRing, newRing *consistentHash.Map, getters map[string]*httpGetter) {
+	// 接收方只接受签名过的交接
+	if len(p.opts.Secret) == 0 {
+		p.logger.Debug("handoff skipped without a secret", "self", p.self)
+		return
+	}
+	limiter := newRateLimiter(p.opts.HandoffRate)
+	members := make(map[string]bool)
+	for _, node := range newRing.Ring() {
+		members[node.Node] = true
+	}
+	for _, g := range p.groups() {
+		batches := make(map[string][]*pb.Entry)
+		g.mainCache.rangeEntries(func(key string, value ByteView) bool {
+			oldOwners := oldRing.GetN(key, p.opts.Replication)
+			if handoffSource(oldOwners, members) != p.self {
+				return true
+			}
+			// 持有缓存锁时读取版本号，之后的失效事件一定会让这个条目作废
+			version := g.versions.load(key)
+			for _, owner := range newRing.GetN(key, p.opts.Replication) {
+				if owner != p.self && !containsString(oldOwners, owner) {
+					batches[owner] = append(batches[owner], &pb.Entry{Key: key, Value: value.bytes(), Version: version})
+				}
+			}
+			return true
+		})
+		for owner, entries := range batches {
+			p.logger.Info("handing off keys", "self", p.self, "group", g.name, "to", owner, "keys", len(entries))
+			for len(entries) > 0 {
+				n := handoffBatchSize
+				if n > len(entries) {
+					n = len(entries)
+				}
+				if err := limiter.waitN(ctx, n); err != nil {
+					p.logger.Warn("handoff aborted", "self", p.self, "err", err)
+					return
+				}
+				if err := getters[owner].handoff(ctx, g.name, entries[:n]); err != nil {
+					p.logger.Error("handoff failed", "self", p.self, "group", g.name, "to", owner, "err", err)
+					break
+				}
+				entries = entries[n:]
+			}
+		}
+	}
+}
+
+// handoffSource 返回负责交接key的旧副本
+func handoffSource(oldOwners []string, members map[string]bool) string {
+	for _, owner := range oldOwners {
+		if members[owner] {
+			return owner
+		}
+	}
+	if len(oldOwners) == 0 {
+		return ""
+	}
+	return oldOwners[0]
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// serveHandoff 接收其他节点交接过来的缓存条目。和推送一样，只接受签名过的
+// 请求，只保存本节点负责的key，并丢弃版本号过期的条目
+func (p *HTTPPool) serveHandoff(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if p.verifier == nil {
+		http.Error(w, "handoffs require a Secret", http.StatusForbidden)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var req pb.HandoffRequest
+	if err = proto.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	group := GetGroup(req.GetGroup())
+	if group == nil {
+		http.Error(w, "no such group:"+req.GetGroup(), http.StatusNotFound)
+		return
+	}
+	from := r.Header.Get(headerForwardedBy)
+	var dropped int
+	for _, e := range req.GetEntries() {
+		key := e.GetKey()
+		if !p.isHandoffTarget(key, from) {
+			dropped++
+			continue
+		}
+		gen := group.generations.load(key)
+		if group.versions.load(key) > e.GetVersion() {
+			dropped++
+			continue
+		}
+		// 本地已有的值可能更新，不覆盖；检查之后收到的失效事件同样会让条目作废
+		if _, ok := group.mainCache.get(key); !ok && group.generations.load(key) == gen {
+			group.populateCache(key, ByteView{b: e.GetValue()})
+		}
+		group.versions.observe(key, e.GetVersion())
+	}
+	if dropped > 0 {
+		p.logger.Debug("dropped handed off entries", "self", p.self, "group", group.name,
+			"from", from, "dropped", dropped)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// isHandoffTarget 判断本节点是否是key的副本节点之一，或者在交接方from离开
+// 哈希环后成为副本节点之一。下线时交接的节点仍在接收方的环上
+func (p *HTTPPool) isHandoffTarget(key, from string) bool {
+	if p.self == "" {
+		return false
+	}
+	p.mu.Lock()
+	ring := p.peers
+	p.mu.Unlock()
+	if ring == nil {
+		return false
+	}
+	n := 0
+	for _, owner := range ring.GetN(key, p.opts.Replication+1) {
+		if owner == from {
+			continue
+		}
+		if owner == p.self {
+			return true
+		}
+		if n++; n == p.opts.Replication {
+			break
+		}
+	}
+	return false
+}
+
+// handoff 把一批缓存条目发送给节点
+func (h *httpGetter) handoff(ctx context.Context, group string, entries []*pb.Entry) error {
+	body, err := proto.Marshal(&pb.HandoffRequest{Group: group, Entries: entries})
+	if err != nil {
+		return err
+	}
+	req, err := h.newRequest(ctx, http.MethodPost, handoffPath, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	res, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("server returned: %v", res.Status)
+	}
+	return nil
+}
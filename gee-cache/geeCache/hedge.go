@@ -0,0 +1,83 @@
+package geeCache
+
+import (
+	"context"
+	"errors"
+	"geeCache/singleflight"
+	"time"
+)
+
+type hedgeResult struct {
+	value    ByteView
+	err      error
+	hedge    bool
+	panicked *singleflight.PanicError // 请求发生了panic
+}
+
+// hedgeLeg 执行一路请求并把结果发送到results。panic也作为结果发送，
+// 由hedgedGet在自己的goroutine上重新panic
+func hedgeLeg(results chan<- hedgeResult, hedge bool, fn func() (ByteView, error)) {
+	r := hedgeResult{hedge: hedge}
+	defer func() {
+		if v := recover(); v != nil {
+			r.panicked = singleflight.NewPanicError(v)
+		}
+		results <- r
+	}()
+	r.value, r.err = fn()
+}
+
+// hedgedGet 向primary发起请求，若hedgeDelay内没有返回，再向backup发起对冲请求，
+// backup为nil时使用本地的getter。返回最先成功的结果，并取消另一个请求；
+// 结果的hedge字段表示它是否来自backup，hedged表示是否发起了对冲请求。
+// 本地getter无法被取消，它加载的值仍会写入本地缓存。
+func (g *Group) hedgedGet(ctx context.Context, primary, backup PeerGetter, key string) (r hedgeResult, hedged bool) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan hedgeResult, 2)
+	go hedgeLeg(results, false, func() (ByteView, error) {
+		return g.getFromPeer(ctx, primary, key)
+	})
+	timer := time.NewTimer(g.hedgeDelay)
+	defer timer.Stop()
+
+	pending := 1
+	var primaryErr error
+	for pending > 0 {
+		select {
+		case <-timer.C:
+			hedged = true
+			pending++
+			g.Stats.HedgesFired.Add(1)
+			go hedgeLeg(results, true, func() (ByteView, error) {
+				if backup == nil {
+					return g.getLocally(key)
+				}
+				return g.getFromPeer(ctx, backup, key)
+			})
+		case r := <-results:
+			pending--
+			if r.panicked != nil {
+				panic(r.panicked)
+			}
+			// key不存在是确定的回答，和成功一样无需等待另一个请求
+			if r.err == nil || errors.Is(r.err, ErrNotFound) {
+				// 只有对冲请求拿到了值才算赢
+				if r.hedge && r.err == nil {
+					g.Stats.HedgesWon.Add(1)
+				}
+				return r, hedged
+			}
+			if !r.hedge {
+				primaryErr = r.err
+			}
+			// owner在对冲之前就失败了，交给调用方按正常流程处理
+			if !hedged {
+				return hedgeResult{err: primaryErr}, false
+			}
+		}
+	}
+	// 两个请求都失败了，返回owner的错误
+	return hedgeResult{err: primaryErr}, hedged
+}
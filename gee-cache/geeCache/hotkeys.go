@@ -0,0 +1,277 @@
+package geeCache
+
+import (
+	"geeCache/lru"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultHotKeyTopK      = 10
+	defaultHotKeyThreshold = 100
+	defaultHotCacheBytes   = 1 << 20
+
+	sketchDepth = 4
+	sketchWidth = 2048
+	// 每记录这么多次请求，所有计数减半，使统计只反映最近的访问
+	sketchDecayAfter = 50000
+)
+
+// HotKey is a frequently requested key and its estimated recent count.
+type HotKey struct {
+	Key   string `json:"key"`
+	Count int64  `json:"count"`
+}
+
+// hotKeys 使用 count-min sketch 估计每个key最近的访问次数，
+// 并维护估计值最大的topK个key，占用的内存与key的数量无关。
+// 每次Get都会调用observe，计数使用原子操作，只有可能进入topK的key才需要加锁
+type hotKeys struct {
+	counts    [sketchDepth][sketchWidth]atomic.Uint32
+	observed  atomic.Int64
+	minTop    atomic.Uint32 // topK已满时其中最小的计数，未满时为0，只会偏小
+	mu        sync.RWMutex  // 保护top
+	top       map[string]*atomic.Uint32
+	k         int
+	threshold uint32
+}
+
+func newHotKeys(k, threshold int) *hotKeys {
+	return &hotKeys{top: make(map[string]*atomic.Uint32, k+1), k: k, threshold: uint32(threshold)}
+}
+
+// index 返回key在每一行中的位置，使用两个哈希值组合出 sketchDepth 个哈希函数
+func (h *hotKeys) index(key string) [sketchDepth]int {
+	f := fnv.New64a()
+	f.Write([]byte(key))
+	sum := f.Sum64()
+	h1, h2 := uint32(sum), uint32(sum>>32)|1
+	var idx [sketchDepth]int
+	for i := range idx {
+		idx[i] = int((h1 + uint32(i)*h2) % sketchWidth)
+	}
+	return idx
+}
+
+// observe 记录一次对key的访问，并报告它是否是热点
+func (h *hotKeys) observe(key string) bool {
+	est := ^uint32(0)
+	for i, j := range h.index(key) {
+		if c := h.counts[i][j].Add(1); c < est {
+			est = c
+		}
+	}
+	if h.observed.Add(1)%sketchDecayAfter == 0 {
+		h.decay()
+	}
+	// 估计值比topK中最小的还小，不可能进入topK
+	if est >= h.minTop.Load() {
+		h.mu.RLock()
+		c, ok := h.top[key]
+		if ok {
+			c.Store(est)
+		}
+		h.mu.RUnlock()
+		if !ok {
+			h.mu.Lock()
+			h.updateTop(key, est)
+			h.mu.Unlock()
+		}
+	}
+	return est >= h.threshold
+}
+
+// isHot 报告key的估计访问次数是否达到阈值
+func (h *hotKeys) isHot(key string) bool {
+	for i, j := range h.index(key) {
+		if h.counts[i][j].Load() < h.threshold {
+			return false
+		}
+	}
+	return true
+}
+
+// updateTop 用key的估计值更新topK，调用时需持有写锁
+func (h *hotKeys) updateTop(key string, est uint32) {
+	if c, ok := h.top[key]; ok {
+		c.Store(est)
+		return
+	}
+	if len(h.top) < h.k {
+		c := &atomic.Uint32{}
+		c.Store(est)
+		h.top[key] = c
+		h.updateMinTop()
+		return
+	}
+	// topK已满，替换其中最小的一个
+	minKey, minCount := "", ^uint32(0)
+	for k, c := range h.top {
+		if v := c.Load(); v < minCount {
+			minKey, minCount = k, v
+		}
+	}
+	if est > minCount {
+		c := h.top[minKey]
+		delete(h.top, minKey)
+		c.Store(est)
+		h.top[key] = c
+	}
+	h.updateMinTop()
+}
+
+// updateMinTop 重新计算minTop，调用时需持有写锁
+func (h *hotKeys) updateMinTop() {
+	if len(h.top) < h.k {
+		h.minTop.Store(0)
+		return
+	}
+	min := ^uint32(0)
+	for _, c := range h.top {
+		if v := c.Load(); v < min {
+			min = v
+		}
+	}
+	h.minTop.Store(min)
+}
+
+// decay 把所有计数减半。与之并发的observe可能丢失少量计数，对估计值没有影响
+func (h *hotKeys) decay() {
+	for i := range h.counts {
+		for j := range h.counts[i] {
+			c := &h.counts[i][j]
+			for v := c.Load(); !c.CompareAndSwap(v, v>>1); v = c.Load() {
+			}
+		}
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for k, c := range h.top {
+		if v := c.Load() >> 1; v == 0 {
+			delete(h.top, k)
+		} else {
+			c.Store(v)
+		}
+	}
+	h.updateMinTop()
+}
+
+// hotKeys 返回当前的热点key，按访问次数从多到少排列
+func (h *hotKeys) hotKeys() []HotKey {
+	h.mu.RLock()
+	keys := make([]HotKey, 0, len(h.top))
+	for k, c := range h.top {
+		keys = append(keys, HotKey{Key: k, Count: int64(c.Load())})
+	}
+	h.mu.RUnlock()
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Count != keys[j].Count {
+			return keys[i].Count > keys[j].Count
+		}
+		return keys[i].Key < keys[j].Key
+	})
+	return keys
+}
+
+// hotEntry 是hotCache中的值，过期后不再使用
+type hotEntry struct {
+	value  ByteView
+	expire time.Time
+}
+
+func (e hotEntry) Len() int {
+	return e.value.Len()
+}
+
+// hotCache 在非owner节点上短暂地缓存热点key，避免每次都访问owner。
+// nil 表示不缓存热点key
+type hotCache struct {
+	mu       sync.Mutex
+	lru      *lru.Cache
+	maxBytes int64
+	ttl      time.Duration
+}
+
+func (c *hotCache) add(key string, value ByteView, now time.Time) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lru == nil {
+		c.lru = lru.NewCache(c.maxBytes, nil)
+	}
+	c.lru.Add(key, hotEntry{value: value, expire: now.Add(c.ttl)})
+}
+
+func (c *hotCache) get(key string, now time.Time) (ByteView, bool) {
+	if c == nil {
+		return ByteView{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lru == nil {
+		return ByteView{}, false
+	}
+	v, ok := c.lru.Get(key)
+	if !ok {
+		return ByteView{}, false
+	}
+	e := v.(hotEntry)
+	if now.After(e.expire) {
+		c.lru.Remove(key)
+		return ByteView{}, false
+	}
+	return e.value, true
+}
+
+func (c *hotCache) remove(key string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lru != nil {
+		c.lru.Remove(key)
+	}
+}
+
+func (c *hotCache) removePrefix(prefix string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lru == nil {
+		return
+	}
+	var keys []string
+	c.lru.Range(func(key string, value lru.Value) bool {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	for _, key := range keys {
+		c.lru.Remove(key)
+	}
+}
+
+func (c *hotCache) purge() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lru = nil
+}
+
+// HotKeys returns the most requested keys of the group over the recent
+// past, most requested first.
+func (g *Group) HotKeys() []HotKey {
+	return g.hot.hotKeys()
+}
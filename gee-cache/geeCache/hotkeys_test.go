@@ -0,0 +1,134 @@
+package geeCache
+
+import (
+	"fmt"
+	pb "geeCache/geecachepb"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHotKeysTopK(t *testing.T) {
+	h := newHotKeys(2, 5)
+	for i := 0; i < 10; i++ {
+		h.observe("a")
+	}
+	for i := 0; i < 5; i++ {
+		h.observe("b")
+	}
+	h.observe("c")
+	keys := h.hotKeys()
+	if len(keys) != 2 || keys[0] != (HotKey{"a", 10}) || keys[1] != (HotKey{"b", 5}) {
+		t.Fatalf("unexpected top keys %v", keys)
+	}
+	if !h.isHot("b") || h.isHot("c") {
+		t.Fatal("expect b hot and c not")
+	}
+	h.decay()
+	if h.isHot("b") || h.hotKeys()[0].Count != 5 {
+		t.Fatal("expect counts halved by decay")
+	}
+}
+
+func TestHotKeysConcurrent(t *testing.T) {
+	h := newHotKeys(2, 5)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				h.observe("a")
+				if j%2 == 0 {
+					h.observe("b")
+				}
+				h.observe(fmt.Sprintf("cold-%d-%d", i, j))
+			}
+		}(i)
+	}
+	wg.Wait()
+	keys := h.hotKeys()
+	if len(keys) != 2 || keys[0].Key != "a" || keys[1].Key != "b" || keys[0].Count < 8000 {
+		t.Fatalf("unexpected top keys %v", keys)
+	}
+}
+
+func TestHotCacheOff(t *testing.T) {
+	owner := &countingPeer{}
+	gee := NewGroupOpts("hot-off", GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("unexpected local load of %s", key)
+		}), 2<<10, &GroupOptions{HotKeyThreshold: 1})
+	gee.RegisterPeers(fakePicker{owner})
+
+	// 没有设置HotCacheTTL时热点key仍然被统计，但不在本地保留副本
+	for i := 0; i < 3; i++ {
+		gee.Get("Tom")
+	}
+	if n := atomic.LoadInt32(&owner.gets); n != 3 || gee.Stats.HotCacheHits.Get() != 0 {
+		t.Fatalf("expect every request sent to the owner, got %d", n)
+	}
+	if keys := gee.HotKeys(); len(keys) != 1 || keys[0].Key != "Tom" {
+		t.Fatalf("expect Tom reported as hot, got %v", keys)
+	}
+}
+
+type countingPeer struct {
+	gets int32
+}
+
+func (p *countingPeer) Get(in *pb.Request, out *pb.Response) error {
+	atomic.AddInt32(&p.gets, 1)
+	out.Value = []byte(db[in.GetKey()])
+	return nil
+}
+
+func TestHotKeyLocalCopy(t *testing.T) {
+	owner := &countingPeer{}
+	gee := NewGroupOpts("hot", GetterFunc(
+		func(key string) ([]byte, error) {
+			t.Fatalf("unexpected local load of %s", key)
+			return nil, nil
+		}), 2<<10, &GroupOptions{HotKeyThreshold: 3, HotCacheTTL: 20 * time.Millisecond})
+	gee.RegisterPeers(fakePicker{owner})
+
+	for i := 0; i < 5; i++ {
+		if v, err := gee.Get("Tom"); err != nil || v.String() != "630" {
+			t.Fatalf("expect 630, got %v %v", v, err)
+		}
+	}
+	// 第三次请求时成为热点，之后的请求使用本地副本
+	if n := atomic.LoadInt32(&owner.gets); n != 3 {
+		t.Fatalf("expect 3 requests to the owner, got %d", n)
+	}
+	if n := gee.Stats.HotCacheHits.Get(); n != 2 {
+		t.Fatalf("expect 2 hot cache hits, got %d", n)
+	}
+	if gee.Cached("Tom") {
+		t.Fatal("expect the hot copy kept out of mainCache")
+	}
+
+	gee.invalidate("Tom", false)
+	gee.Get("Tom")
+	if n := atomic.LoadInt32(&owner.gets); n != 4 {
+		t.Fatalf("expect an invalidated hot copy to be refetched, got %d requests", n)
+	}
+	time.Sleep(30 * time.Millisecond)
+	gee.Get("Tom")
+	if n := atomic.LoadInt32(&owner.gets); n != 5 {
+		t.Fatalf("expect an expired hot copy to be refetched, got %d requests", n)
+	}
+
+	srv := httptest.NewServer(NewAdminHandler("/_admin/", NewHTTPPool("http://self")))
+	defer srv.Close()
+	var hot []HotKey
+	if code := adminDo(t, http.MethodGet, srv.URL+"/_admin/groups/hot/hot", &hot); code != http.StatusOK {
+		t.Fatalf("expect 200, got %d", code)
+	}
+	if len(hot) != 1 || hot[0].Key != "Tom" || hot[0].Count != 7 {
+		t.Fatalf("unexpected hot keys %v", hot)
+	}
+}
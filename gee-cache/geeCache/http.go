@@ -1,40 +1,191 @@
 package geeCache
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"geeCache/consistentHash"
 	pb "geeCache/geecachepb"
-	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/proto"
+	"io"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 const (
-	defaultBasePath = "/_geecache/"
-	defaultReplicas = 50
+	defaultBasePath    = "/_geecache/"
+	defaultReplicas    = 50
+	defaultReplication = 1
 )
 
 type HTTPPool struct {
 	self        string // 用来记录自己的地址，包括主机名/IP和端口
 	basePath    string // basePath 节点间通讯地址的前缀，
+	opts        HTTPPoolOptions
+	client      *http.Client     // 访问其他节点使用的http客户端
+	verifier    *requestVerifier // 设置了Secret时校验请求签名
+	tracer      Tracer
+	logger      Logger
 	mu          sync.Mutex
+	server      *http.Server // ListenAndServe 或 Serve 启动的服务
+	closed      bool         // Shutdown 已经调用过，不再启动服务
+	peerList    []string
+	version     string                 // 哈希环的版本，随请求发给其他节点
+	mismatches  map[string]string      // 已经记录过的哈希环不一致的节点及其版本
+	dedup       eventDedup             // 已经应用过的失效事件
 	peers       *consistentHash.Map    // 用来根据具体key选择节点
 	httpGetters map[string]*httpGetter // 映射远程节点和对应的httpGetter, keyed by e.g. "http://10.0.0.2:8008"
+	handoffMu   sync.Mutex             // 串行化数据交接
+	handedOff   *consistentHash.Map    // 缓存数据最近一次交接到的环，由mu保护
+}
+
+// HTTPPoolOptions are the configurations of a HTTPPool.
+type HTTPPoolOptions struct {
+	// BasePath specifies the HTTP path that will serve geecache requests.
+	// If blank, it defaults to "/_geecache/".
+	BasePath string
+
+	// Replicas specifies the number of virtual nodes per peer on the
+	// consistent hash. If blank, it defaults to 50.
+	Replicas int
+
+	// Replication is the number of distinct peers that hold a copy of
+	// each key. If blank, it defaults to 1. Values loaded by one owner
+	// are pushed to the others only when Secret is set.
+	Replication int
+
+	// HandoffRate limits how many cached entries per second are streamed
+	// to their new owners after Set changes the peer list. Entries are
+	// handed off only when Secret is set. If blank, it defaults to 1000.
+	HandoffRate int
+
+	// BreakerFailureRate is the failure rate within BreakerWindow at which
+	// the circuit breaker of a peer opens. If blank, it defaults to 0.5.
+	BreakerFailureRate float64
+
+	// BreakerMinRequests is the number of requests within BreakerWindow
+	// before the failure rate is considered. If blank, it defaults to 10.
+	BreakerMinRequests int
+
+	// BreakerWindow is the period over which failures are counted.
+	// If blank, it defaults to 10s.
+	BreakerWindow time.Duration
+
+	// BreakerCooldown is how long an open breaker fails fast before it
+	// lets a probe request through. If blank, it defaults to 5s.
+	BreakerCooldown time.Duration
+
+	// Secret is the HMAC key shared by all peers. If set, every peer
+	// request is signed and unsigned requests are rejected. Without it
+	// the pool refuses replica pushes and writes forwarded by other peers.
+	Secret []byte
+
+	// MaxClockSkew bounds how old or how far in the future a signed
+	// request's timestamp may be. If blank, it defaults to 30s.
+	MaxClockSkew time.Duration
+
+	// HandoffOnShutdown makes Shutdown stream the entries this peer owns
+	// to the peers that take them over once it has left the ring.
+	HandoffOnShutdown bool
+
+	// TLSConfig is used by the client talking to other peers. Peers
+	// must then be addressed as https://. See NewMutualTLSConfig.
+	TLSConfig *tls.Config
+
+	// Tracer receives a span for every peer request sent and served.
+	// If blank, spans are not recorded but incoming traceparent headers
+	// are still passed on to the next hop.
+	Tracer Tracer
+
+	// InvalidateRetries is how many times an invalidation is resent to a
+	// peer that did not acknowledge it. If blank, it defaults to 3.
+	InvalidateRetries int
+
+	// InvalidateBackoff is the delay before the first resend of an
+	// invalidation; it doubles on every retry. If blank, it defaults to 100ms.
+	InvalidateBackoff time.Duration
+
+	// InvalidateTimeout bounds each attempt to deliver an invalidation to
+	// a peer. If blank, it defaults to 1s.
+	InvalidateTimeout time.Duration
+
+	// Logger receives the pool's logs, with per-request logs at debug
+	// level. If blank, only warnings and errors are written to stderr.
+	Logger Logger
 }
 
 func NewHTTPPool(self string) *HTTPPool {
-	return &HTTPPool{
-		self:     self,
-		basePath: defaultBasePath,
+	return NewHTTPPoolOpts(self, nil)
+}
+
+// NewHTTPPoolOpts initializes an HTTP pool of peers with the given options.
+func NewHTTPPoolOpts(self string, o *HTTPPoolOptions) *HTTPPool {
+	p := &HTTPPool{
+		self:   self,
+		client: http.DefaultClient,
+	}
+	if o != nil {
+		p.opts = *o
+	}
+	if p.opts.BasePath == "" {
+		p.opts.BasePath = defaultBasePath
+	}
+	if p.opts.Replicas == 0 {
+		p.opts.Replicas = defaultReplicas
+	}
+	if p.opts.HandoffRate <= 0 {
+		p.opts.HandoffRate = defaultHandoffRate
 	}
+	if p.opts.Replication <= 0 {
+		p.opts.Replication = defaultReplication
+	}
+	if p.opts.InvalidateRetries <= 0 {
+		p.opts.InvalidateRetries = defaultInvalidateRetries
+	}
+	if p.opts.InvalidateBackoff <= 0 {
+		p.opts.InvalidateBackoff = defaultInvalidateBackoff
+	}
+	if p.opts.InvalidateTimeout <= 0 {
+		p.opts.InvalidateTimeout = defaultInvalidateTimeout
+	}
+	p.basePath = p.opts.BasePath
+	p.tracer = p.opts.Tracer
+	if p.tracer == nil {
+		p.tracer = nopTracer{}
+	}
+	p.logger = p.opts.Logger
+	if p.logger == nil {
+		p.logger = defaultLogger
+	}
+	if len(p.opts.Secret) > 0 {
+		p.verifier = newRequestVerifier(p.opts.Secret, p.opts.MaxClockSkew)
+	}
+	if p.opts.TLSConfig != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = p.opts.TLSConfig
+		p.client = &http.Client{Transport: transport}
+	}
+	return p
+}
+
+// TLSConfig returns the TLS configuration the pool was created with,
+// suitable for http.Server.TLSConfig.
+func (p *HTTPPool) TLSConfig() *tls.Config {
+	return p.opts.TLSConfig
 }
 
+// Log writes an info level message to the pool's Logger.
+//
+// Deprecated: configure HTTPPoolOptions.Logger instead.
 func (p *HTTPPool) Log(format string, v ...interface{}) {
-	log.Printf("[Server %s] %s", p.self, fmt.Sprintf(format, v...))
+	p.logger.Info(fmt.Sprintf(format, v...), "self", p.self)
 }
 
 func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -42,7 +193,42 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if !strings.HasPrefix(r.URL.Path, p.basePath) {
 		panic("HTTPPool serving unexpected path: " + r.URL.Path)
 	}
-	p.Log("%s %s", r.Method, r.URL.Path)
+	p.logger.Debug("serving peer request", "self", p.self, "method", r.Method, "path", r.URL.Path)
+	// 延续上一跳传过来的trace
+	ctx, span := p.tracer.Start(extractTraceParent(r.Context(), r.Header), "geecache.ServeHTTP",
+		Attr("peer", p.self), Attr("method", r.Method), Attr("path", r.URL.Path))
+	sw := &statusWriter{ResponseWriter: w, code: http.StatusOK}
+	defer func() {
+		span.SetAttributes(Attr("status", sw.code))
+		var err error
+		if sw.code >= 400 {
+			err = fmt.Errorf("status %d", sw.code)
+		}
+		span.End(err)
+	}()
+	w, r = sw, r.WithContext(ctx)
+
+	if p.verifier != nil {
+		if err := p.verifier.verify(r, time.Now()); err != nil {
+			p.logger.Warn("rejected peer request", "self", p.self, "remote", r.RemoteAddr, "err", err)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+	}
+	// 其他节点转发来的请求不再转发，直接在本地加载
+	if from := r.Header.Get(headerForwardedBy); from != "" {
+		p.checkRing(from, r.Header.Get(headerRingVersion))
+		span.SetAttributes(Attr("forwarded_by", from))
+		r = r.WithContext(withForwarded(r.Context()))
+	}
+	switch r.URL.Path {
+	case p.basePath + handoffPath:
+		p.serveHandoff(w, r)
+		return
+	case p.basePath + invalidatePath:
+		p.serveInvalidate(w, r)
+		return
+	}
 
 	// 约定访问路径格式为 /<basepath>/<groupname>/<key> required
 	parts := strings.SplitN(r.URL.Path[len(p.basePath):], "/", 2)
@@ -55,19 +241,32 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	groupName := parts[0]
 	group := GetGroup(groupName)
 	if group == nil {
-		http.Error(w, "no such group:"+groupName, http.StatusNotFound)
+		writeErrorResponse(w, fmt.Errorf("%w: %s", ErrNoSuchGroup, groupName))
 		return
 	}
 
-	// 通过group.Get(key)得到缓存数据
 	key := parts[1]
-	view, err := group.Get(key)
+	span.SetAttributes(Attr("group", groupName), Attr("key", key))
+	group.Stats.ServerRequests.Add(1)
+	// PUT 请求是owner推送过来的副本，直接写入本地缓存
+	if r.Method == http.MethodPut {
+		p.servePush(w, r, group, key)
+		return
+	}
+	// POST 请求是转发给owner的写入
+	if r.Method == http.MethodPost {
+		p.serveSet(w, r, group, key)
+		return
+	}
+
+	// 通过group.Get(key)得到缓存数据
+	view, err := group.GetContext(r.Context(), key)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeErrorResponse(w, err)
 		return
 	}
 
-	body, err := proto.Marshal(&pb.Response{Value: view.ByteSlice()})
+	body, err := proto.Marshal(&pb.Response{Value: view.bytes()})
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -78,19 +277,175 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 }
 
+// writeErrorResponse 把错误写入Response的error字段，并设置对应的状态码
+func writeErrorResponse(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrNoSuchGroup):
+		code = http.StatusNotFound
+	case errors.Is(err, ErrOverloaded):
+		// 通知调用方稍后重试
+		w.Header().Set("Retry-After", "1")
+		code = http.StatusServiceUnavailable
+	}
+	body, merr := proto.Marshal(&pb.Response{Error: toProtoError(err)})
+	if merr != nil {
+		http.Error(w, err.Error(), code)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.WriteHeader(code)
+	w.Write(body)
+}
+
+// statusWriter 记录返回的状态码，供span使用
+type statusWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.code = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// servePush 接收owner推送过来的副本。推送会绕过数据源直接写入缓存，
+// 所以只接受签名过的请求，并且只保存本节点负责的key
+func (p *HTTPPool) servePush(w http.ResponseWriter, r *http.Request, group *Group, key string) {
+	if p.verifier == nil {
+		http.Error(w, "pushes require a Secret", http.StatusForbidden)
+		return
+	}
+	if !p.isOwner(key) {
+		http.Error(w, "not a replica of "+key, http.StatusMisdirectedRequest)
+		return
+	}
+	version, err := strconv.ParseInt(r.URL.Query().Get("version"), 10, 64)
+	if err != nil {
+		http.Error(w, "bad version", http.StatusBadRequest)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var res pb.Response
+	if err = proto.Unmarshal(body, &res); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// 本节点见过比加载开始时更新的版本号，推送的值可能已经过期
+	gen := group.generations.load(key)
+	if group.versions.load(key) > version {
+		p.logger.Debug("dropped stale push", "self", p.self, "group", group.name, "key", key)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	// 检查之后收到的失效事件同样会让推送作废
+	if group.generations.load(key) == gen {
+		group.populateCache(key, ByteView{b: res.Value})
+	}
+	group.versions.observe(key, version)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// isOwner 判断本节点是否是key的副本节点之一
+func (p *HTTPPool) isOwner(key string) bool {
+	if p.self == "" {
+		return false
+	}
+	for _, owner := range p.Owners(key) {
+		if owner == p.self {
+			return true
+		}
+	}
+	return false
+}
+
+// serveSet 接收其他节点转发来的写入。写入会直接落到数据源，所以同样只接受
+// 签名过的请求，并且只处理本节点负责的key
+func (p *HTTPPool) serveSet(w http.ResponseWriter, r *http.Request, group *Group, key string) {
+	if p.verifier == nil {
+		http.Error(w, "writes require a Secret", http.StatusForbidden)
+		return
+	}
+	if !p.isOwner(key) {
+		http.Error(w, "not an owner of "+key, http.StatusMisdirectedRequest)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var res pb.Response
+	if err = proto.Unmarshal(body, &res); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := group.SetContext(r.Context(), key, res.Value); err != nil {
+		writeErrorResponse(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
 // Set updates the pool's list of peers.
 func (p *HTTPPool) Set(peers ...string) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
+	oldPeers := p.peerList
+	p.peerList = append([]string(nil), peers...)
+	p.version = ringVersion(peers, p.opts.Replicas, p.opts.Replication)
 	// 实例化一致性哈希算法
-	p.peers = consistentHash.New(defaultReplicas, nil)
+	p.peers = consistentHash.New(p.opts.Replicas, nil)
 	// 将传入的节点加入一致性哈希算法中
 	p.peers.Add(peers...)
 	// 并为每个节点创建一个对应的http客户端 httpGetter
-	p.httpGetters = make(map[string]*httpGetter, len(peers))
+	// 保留仍在列表中的节点的httpGetter，以免丢失断路器的状态
+	getters := make(map[string]*httpGetter, len(peers))
 	for _, peer := range peers {
-		p.httpGetters[peer] = &httpGetter{baseURL: peer + p.basePath}
+		if h, ok := p.httpGetters[peer]; ok {
+			getters[peer] = h
+			continue
+		}
+		getters[peer] = p.newHTTPGetter(peer)
 	}
+	p.httpGetters = getters
+	// 节点列表变化后，把key交给新增的副本节点
+	if len(oldPeers) == 0 {
+		p.handedOff = p.peers
+	} else if len(peers) > 0 {
+		go p.rebalance()
+	}
+}
+
+func (p *HTTPPool) newHTTPGetter(peer string) *httpGetter {
+	return &httpGetter{
+		baseURL: peer + p.basePath,
+		client:  p.client,
+		secret:  p.opts.Secret,
+		tracer:  p.tracer,
+		self:    p.self,
+		version: p.RingVersion,
+		breaker: newBreaker(&p.opts, func(from, to BreakerState) {
+			p.logger.Warn("circuit breaker changed state", "self", p.self, "peer", peer, "from", from, "to", to)
+		}),
+	}
+}
+
+// BreakerStates returns the circuit breaker state of every remote peer.
+func (p *HTTPPool) BreakerStates() map[string]BreakerState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	states := make(map[string]BreakerState, len(p.httpGetters))
+	for peer, h := range p.httpGetters {
+		if peer != p.self {
+			states[peer] = h.breaker.State()
+		}
+	}
+	return states
 }
 
 // PickPeer picks a peer according to key
@@ -100,44 +455,123 @@ func (p *HTTPPool) PickPeer(key string) (PeerGetter, bool) {
 	// 包装了一致性哈希算法的Get()方法，根据具体的key，选择节点
 	// 注意这里已经包含了peer != p.self
 	if peer := p.peers.Get(key); peer != "" && peer != p.self {
-		p.Log("Pick peer %s", peer)
+		p.logger.Debug("picked peer", "self", p.self, "key", key, "peer", peer)
 		// 返回节点对应的http客户端
 		return p.httpGetters[peer], true
 	}
 	return nil, false
 }
 
+// PickPeers picks the Replication owners of key, in ring order.
+// 本节点在返回结果中用nil表示
+func (p *HTTPPool) PickPeers(key string) []PeerGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers == nil {
+		return []PeerGetter{nil}
+	}
+	names := p.peers.GetN(key, p.opts.Replication)
+	if len(names) == 0 {
+		return []PeerGetter{nil}
+	}
+	owners := make([]PeerGetter, len(names))
+	for i, name := range names {
+		if name != p.self {
+			owners[i] = p.httpGetters[name]
+		}
+	}
+	p.logger.Debug("picked peers", "self", p.self, "key", key, "peers", names)
+	return owners
+}
+
+// Self returns the address of this peer.
+func (p *HTTPPool) Self() string {
+	return p.self
+}
+
+// Peers returns the current peer list.
+func (p *HTTPPool) Peers() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.peerList...)
+}
+
+// Owners returns the addresses of the peers holding key, primary first.
+func (p *HTTPPool) Owners(key string) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers == nil {
+		return nil
+	}
+	return p.peers.GetN(key, p.opts.Replication)
+}
+
+// Ring returns the virtual node layout of the consistent hash.
+func (p *HTTPPool) Ring() []consistentHash.VirtualNode {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers == nil {
+		return nil
+	}
+	return p.peers.Ring()
+}
+
 var _ PeerPicker = (*HTTPPool)(nil)
+var _ ReplicaPicker = (*HTTPPool)(nil)
 
 // http客户端类
 type httpGetter struct {
 	baseURL string // 表示将要访问的远程节点的地址
 	// e.g. http://example.com/_geecache/
+	client  *http.Client
+	secret  []byte   // 非空时为每个请求签名
+	breaker *breaker // 节点持续失败时快速失败
+	tracer  Tracer   // 为nil时不记录span
+
+	self    string        // 本节点的地址，非空时把请求标记为转发的
+	version func() string // 本节点的哈希环版本
 }
 
 func (h *httpGetter) Get(in *pb.Request, out *pb.Response) error {
-	u := fmt.Sprintf(
-		"%v%v/%v",
-		h.baseURL,
-		url.QueryEscape(in.GetGroup()),
-		url.QueryEscape(in.GetKey()),
-	)
+	return h.GetContext(context.Background(), in, out)
+}
+
+func (h *httpGetter) GetContext(ctx context.Context, in *pb.Request, out *pb.Response) (err error) {
+	if h.tracer != nil {
+		var span Span
+		ctx, span = h.tracer.Start(ctx, "geecache.httpGetter.Get",
+			Attr("peer", h.baseURL), Attr("group", in.GetGroup()), Attr("key", in.GetKey()))
+		defer func() { span.End(err) }()
+	}
+	if err := h.breaker.allow(); err != nil {
+		return err
+	}
+	err = h.get(ctx, in, out)
+	// key不存在不算节点失败
+	h.breaker.record(ctx, isPeerFailure(err))
+	return err
+}
 
-	// 使用http.Get() 获取返回值
-	res, err := http.Get(u)
+func (h *httpGetter) get(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	req, err := h.newRequest(ctx, http.MethodGet, keyPath(in), nil)
+	if err != nil {
+		return err
+	}
+	// 使用http客户端获取返回值
+	res, err := h.client.Do(req)
 	if err != nil {
 		return err
 	}
 	defer res.Body.Close()
 
-	if res.StatusCode != http.StatusOK {
-		return fmt.Errorf("server returned: %v", res.Status)
-	}
 	// 并转换为[]byte类型
 	bytes, err := ioutil.ReadAll(res.Body)
 	if err != nil {
 		return fmt.Errorf("reading response body: %v", err)
 	}
+	if res.StatusCode != http.StatusOK {
+		return responseError(res, bytes)
+	}
 
 	if err = proto.Unmarshal(bytes, out); err != nil {
 		return fmt.Errorf("decoding response body: %v", err)
@@ -146,4 +580,93 @@ func (h *httpGetter) Get(in *pb.Request, out *pb.Response) error {
 	return nil
 }
 
+// responseError 把失败的响应转换为错误，优先使用Response中的结构化错误
+func responseError(res *http.Response, body []byte) error {
+	var errRes pb.Response
+	if proto.Unmarshal(body, &errRes) == nil && errRes.Error != nil {
+		return fromProtoError(errRes.Error)
+	}
+	if res.StatusCode == http.StatusServiceUnavailable {
+		return ErrOverloaded
+	}
+	return fmt.Errorf("server returned: %v", res.Status)
+}
+
+// Set sends a write to the peer owning the key.
+func (h *httpGetter) Set(ctx context.Context, in *pb.Request, value []byte) error {
+	body, err := proto.Marshal(&pb.Response{Value: value})
+	if err != nil {
+		return err
+	}
+	req, err := h.newRequest(ctx, http.MethodPost, keyPath(in), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	res, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(res.Body)
+		return responseError(res, body)
+	}
+	return nil
+}
+
+// Push sends a freshly loaded value to the peer so it can serve it as a
+// replica. version is the key's version when the load started; the peer
+// drops the value if it has seen a newer version of the key.
+func (h *httpGetter) Push(in *pb.Request, value []byte, version int64) error {
+	body, err := proto.Marshal(&pb.Response{Value: value})
+	if err != nil {
+		return err
+	}
+	path := keyPath(in) + "?version=" + strconv.FormatInt(version, 10)
+	req, err := h.newRequest(context.Background(), http.MethodPut, path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	res, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("server returned: %v", res.Status)
+	}
+	return nil
+}
+
+// keyPath 返回 <groupname>/<key> 形式的相对路径
+func keyPath(in *pb.Request) string {
+	return fmt.Sprintf(
+		"%v/%v",
+		url.QueryEscape(in.GetGroup()),
+		url.QueryEscape(in.GetKey()),
+	)
+}
+
+// newRequest 构造访问 /<basepath>/<path> 的请求，带上traceparent并在需要时签名
+func (h *httpGetter) newRequest(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, h.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	injectTraceParent(ctx, req.Header)
+	if h.self != "" {
+		req.Header.Set(headerForwardedBy, h.self)
+		req.Header.Set(headerRingVersion, h.version())
+	}
+	if len(h.secret) > 0 {
+		if err := SignRequest(req, h.secret); err != nil {
+			return nil, err
+		}
+	}
+	return req, nil
+}
+
 var _ PeerGetter = (*httpGetter)(nil)
+var _ ContextPeerGetter = (*httpGetter)(nil)
+var _ PeerPusher = (*httpGetter)(nil)
+var _ PeerSetter = (*httpGetter)(nil)
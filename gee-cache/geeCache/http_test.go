@@ -0,0 +1,562 @@
+package geeCache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"geeCache/consistentHash"
+	pb "geeCache/geecachepb"
+	"geeCache/singleflight"
+	"google.golang.org/protobuf/proto"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testSecret = []byte("geecache-test-secret")
+
+func newAuthTestServer(t *testing.T) (*HTTPPool, *httptest.Server) {
+	NewGroup("auth", GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("v:" + key), nil
+		}), 2<<10)
+	pool := NewHTTPPoolOpts("", &HTTPPoolOptions{Secret: testSecret})
+	srv := httptest.NewServer(pool)
+	t.Cleanup(srv.Close)
+	return pool, srv
+}
+
+func doSigned(t *testing.T, url string, secret []byte, now time.Time, tamper func(*http.Request)) int {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret != nil {
+		if err := signRequest(req, secret, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if tamper != nil {
+		tamper(req)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	return res.StatusCode
+}
+
+func TestSignedRequest(t *testing.T) {
+	_, srv := newAuthTestServer(t)
+	if code := doSigned(t, srv.URL+"/_geecache/auth/Tom", testSecret, time.Now(), nil); code != http.StatusOK {
+		t.Fatalf("signed request: expect 200, got %d", code)
+	}
+}
+
+func TestRejectedRequest(t *testing.T) {
+	_, srv := newAuthTestServer(t)
+	u := srv.URL + "/_geecache/auth/Tom"
+	if code := doSigned(t, u, nil, time.Now(), nil); code != http.StatusUnauthorized {
+		t.Fatalf("unsigned request: expect 401, got %d", code)
+	}
+	if code := doSigned(t, u, []byte("wrong"), time.Now(), nil); code != http.StatusUnauthorized {
+		t.Fatalf("wrong secret: expect 401, got %d", code)
+	}
+}
+
+func TestExpiredRequest(t *testing.T) {
+	_, srv := newAuthTestServer(t)
+	u := srv.URL + "/_geecache/auth/Tom"
+	if code := doSigned(t, u, testSecret, time.Now().Add(-time.Minute), nil); code != http.StatusUnauthorized {
+		t.Fatalf("expired request: expect 401, got %d", code)
+	}
+	if code := doSigned(t, u, testSecret, time.Now().Add(time.Minute), nil); code != http.StatusUnauthorized {
+		t.Fatalf("future request: expect 401, got %d", code)
+	}
+}
+
+func TestTamperedRequest(t *testing.T) {
+	_, srv := newAuthTestServer(t)
+	u := srv.URL + "/_geecache/auth/Tom"
+	tampered := map[string]func(*http.Request){
+		"path": func(r *http.Request) { r.URL.Path = "/_geecache/auth/Jack" },
+		"timestamp": func(r *http.Request) {
+			r.Header.Set(headerTimestamp, r.Header.Get(headerTimestamp)+"0")
+		},
+		"nonce":     func(r *http.Request) { r.Header.Set(headerNonce, "00") },
+		"forwarded": func(r *http.Request) { r.Header.Set(headerForwardedBy, "http://evil") },
+		"ring":      func(r *http.Request) { r.Header.Set(headerRingVersion, "1") },
+	}
+	for name, fn := range tampered {
+		if code := doSigned(t, u, testSecret, time.Now(), fn); code != http.StatusUnauthorized {
+			t.Errorf("tampered %s: expect 401, got %d", name, code)
+		}
+	}
+}
+
+func TestReplayedRequest(t *testing.T) {
+	_, srv := newAuthTestServer(t)
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/_geecache/auth/Tom", nil)
+	if err := SignRequest(req, testSecret); err != nil {
+		t.Fatal(err)
+	}
+	for i, expect := range []int{http.StatusOK, http.StatusUnauthorized} {
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != expect {
+			t.Fatalf("attempt %d: expect %d, got %d", i, expect, res.StatusCode)
+		}
+	}
+}
+
+func TestHTTPGetterSigns(t *testing.T) {
+	_, srv := newAuthTestServer(t)
+	client := NewHTTPPoolOpts("", &HTTPPoolOptions{Secret: testSecret})
+	client.Set(srv.URL)
+	peer, ok := client.PickPeer("Tom")
+	if !ok {
+		t.Fatal("expect remote peer")
+	}
+	res := &pb.Response{}
+	if err := peer.Get(&pb.Request{Group: "auth", Key: "Tom"}, res); err != nil {
+		t.Fatal(err)
+	}
+	if string(res.Value) != "v:Tom" {
+		t.Fatalf("expect v:Tom, got %s", res.Value)
+	}
+}
+
+func TestHandoff(t *testing.T) {
+	received := make(chan *pb.HandoffRequest, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		req := &pb.HandoffRequest{}
+		if err := proto.Unmarshal(body, req); err != nil {
+			t.Error(err)
+		}
+		received <- req
+	}))
+	defer srv.Close()
+
+	self := "http://self"
+	pool := NewHTTPPoolOpts(self, &HTTPPoolOptions{Secret: testSecret})
+	pool.Set(self)
+	gee := NewGroup("handoff", GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), 2<<20)
+	gee.RegisterPeers(pool)
+	for i := 0; i < 50; i++ {
+		key := strconv.Itoa(i)
+		gee.populateCache(key, ByteView{b: []byte(key)})
+	}
+
+	pool.Set(self, srv.URL)
+	select {
+	case req := <-received:
+		if req.GetGroup() != "handoff" || len(req.GetEntries()) == 0 {
+			t.Fatalf("unexpected handoff %v", req)
+		}
+		for _, e := range req.GetEntries() {
+			if owner := pool.peers.Get(e.GetKey()); owner != srv.URL {
+				t.Errorf("key %s handed off to %s, but owned by %s", e.GetKey(), srv.URL, owner)
+			}
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no entries were handed off")
+	}
+}
+
+// newHandoffRecorder 启动一个记录收到的交接请求的节点
+func newHandoffRecorder(t *testing.T) (*httptest.Server, chan *pb.HandoffRequest) {
+	received := make(chan *pb.HandoffRequest, 100)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		req := &pb.HandoffRequest{}
+		if err := proto.Unmarshal(body, req); err != nil {
+			t.Error(err)
+		}
+		received <- req
+	}))
+	t.Cleanup(srv.Close)
+	return srv, received
+}
+
+func TestHandoffToReplicas(t *testing.T) {
+	a, fromA := newHandoffRecorder(t)
+	b, fromB := newHandoffRecorder(t)
+	self := "http://self"
+	pool := NewHTTPPoolOpts(self, &HTTPPoolOptions{Replication: 2, Secret: testSecret})
+	pool.Set(self)
+	gee := NewGroup("handoff-replicas", GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), 2<<20)
+	gee.RegisterPeers(pool)
+	for i := 0; i < 50; i++ {
+		key := strconv.Itoa(i)
+		gee.populateCache(key, ByteView{b: []byte(key)})
+	}
+
+	// 本节点是所有key唯一的旧副本，新的环上除本节点外的每个副本都应收到key
+	pool.Set(self, a.URL, b.URL)
+	want := map[string]int{}
+	for i := 0; i < 50; i++ {
+		for _, owner := range pool.Owners(strconv.Itoa(i)) {
+			if owner != self {
+				want[owner]++
+			}
+		}
+	}
+	got := map[string]int{}
+	timeout := time.After(time.Second)
+	for got[a.URL] != want[a.URL] || got[b.URL] != want[b.URL] {
+		select {
+		case req := <-fromA:
+			got[a.URL] += len(req.GetEntries())
+		case req := <-fromB:
+			got[b.URL] += len(req.GetEntries())
+		case <-timeout:
+			t.Fatalf("expect %v entries handed off, got %v", want, got)
+		}
+	}
+}
+
+func TestHandoffRate(t *testing.T) {
+	srv, received := newHandoffRecorder(t)
+	self := "http://self"
+	pool := NewHTTPPoolOpts(self, &HTTPPoolOptions{HandoffRate: 1000, Secret: testSecret})
+	gee := NewGroup("handoff-rate", GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), 2<<20)
+	gee.RegisterPeers(pool)
+	for i := 0; i < 300; i++ {
+		key := strconv.Itoa(i)
+		gee.populateCache(key, ByteView{b: []byte(key)})
+	}
+
+	// 所有key都交给srv，每秒1000个条目，300个条目分3批至少需要200ms
+	oldRing, newRing := consistentHash.New(50, nil), consistentHash.New(50, nil)
+	oldRing.Add(self)
+	newRing.Add(srv.URL)
+	start := time.Now()
+	pool.handoff(context.Background(), oldRing, newRing, map[string]*httpGetter{srv.URL: pool.newHTTPGetter(srv.URL)})
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Fatalf("expect handoff limited to 1000 entries/s, took %v", elapsed)
+	}
+	if n := len(received); n != 3 {
+		t.Fatalf("expect 3 batches, got %d", n)
+	}
+	for len(received) > 0 {
+		if req := <-received; len(req.GetEntries()) > handoffBatchSize {
+			t.Fatalf("batch of %d entries exceeds %d", len(req.GetEntries()), handoffBatchSize)
+		}
+	}
+}
+
+func TestServeHandoff(t *testing.T) {
+	gee := NewGroup("handoff-target", GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("%s not exist", key)
+		}), 2<<10)
+	self := "http://self"
+	handoff := func(opts *HTTPPoolOptions, owner string, entries ...*pb.Entry) error {
+		pool := NewHTTPPoolOpts(self, opts)
+		pool.Set(owner)
+		srv := httptest.NewServer(pool)
+		defer srv.Close()
+		getter := &httpGetter{baseURL: srv.URL + defaultBasePath, client: http.DefaultClient, secret: opts.Secret}
+		return getter.handoff(context.Background(), "handoff-target", entries)
+	}
+	cached := func(key string) bool {
+		_, ok := gee.mainCache.get(key)
+		return ok
+	}
+
+	// 没有Secret时拒绝交接，任何节点都可以借此往缓存里写入任意值
+	if err := handoff(&HTTPPoolOptions{}, self, &pb.Entry{Key: "Tom", Value: []byte("630")}); err == nil {
+		t.Fatal("expect unsigned handoff to be rejected")
+	}
+	if cached("Tom") {
+		t.Fatal("unsigned handoff was cached")
+	}
+
+	signed := &HTTPPoolOptions{Secret: testSecret}
+	// 不是key的副本节点时丢弃
+	if err := handoff(signed, "http://other", &pb.Entry{Key: "Tom", Value: []byte("630")}); err != nil {
+		t.Fatal(err)
+	}
+	if cached("Tom") {
+		t.Fatal("handoff of a key owned by another peer was cached")
+	}
+
+	// 交接开始后key又被失效过，条目已经过期
+	gee.versions.observe("Jack", 5)
+	if err := handoff(signed, self, &pb.Entry{Key: "Jack", Value: []byte("589"), Version: 4}); err != nil {
+		t.Fatal(err)
+	}
+	if cached("Jack") {
+		t.Fatal("stale handoff was cached")
+	}
+
+	if err := handoff(signed, self,
+		&pb.Entry{Key: "Tom", Value: []byte("630")},
+		&pb.Entry{Key: "Jack", Value: []byte("589"), Version: 5}); err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]string{"Tom": "630", "Jack": "589"} {
+		if view, err := gee.Get(key); err != nil || view.String() != want {
+			t.Fatalf("expect handed off value %s, got %v %v", want, view, err)
+		}
+	}
+}
+
+func TestServeHandoffFromLeavingPeer(t *testing.T) {
+	gee := NewGroup("handoff-leaving", GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("%s not exist", key)
+		}), 2<<10)
+	self, leaving := "http://self", "http://leaving"
+	pool := NewHTTPPoolOpts(self, &HTTPPoolOptions{Secret: testSecret})
+	pool.Set(self, leaving)
+	srv := httptest.NewServer(pool)
+	defer srv.Close()
+
+	// 下线的节点交接时还在接收方的环上，它离开后由本节点接手的key也要接受
+	var key string
+	for i := 0; key == ""; i++ {
+		if k := strconv.Itoa(i); pool.Owners(k)[0] == leaving {
+			key = k
+		}
+	}
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath, client: http.DefaultClient, secret: testSecret,
+		self: leaving, version: func() string { return "" }}
+	if err := getter.handoff(context.Background(), "handoff-leaving", []*pb.Entry{{Key: key, Value: []byte("v")}}); err != nil {
+		t.Fatal(err)
+	}
+	if view, err := gee.Get(key); err != nil || view.String() != "v" {
+		t.Fatalf("expect handed off value v, got %v %v", view, err)
+	}
+}
+
+func TestServePush(t *testing.T) {
+	gee := NewGroup("push-target", GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("%s not exist", key)
+		}), 2<<10)
+	self := "http://self"
+	push := func(opts *HTTPPoolOptions, owner, key string, version int64) error {
+		pool := NewHTTPPoolOpts(self, opts)
+		pool.Set(owner)
+		srv := httptest.NewServer(pool)
+		defer srv.Close()
+		getter := &httpGetter{baseURL: srv.URL + defaultBasePath, client: http.DefaultClient, secret: opts.Secret}
+		return getter.Push(&pb.Request{Group: "push-target", Key: key}, []byte("630"), version)
+	}
+	signed := &HTTPPoolOptions{Secret: testSecret, Logger: DiscardLogger}
+
+	if err := push(&HTTPPoolOptions{Logger: DiscardLogger}, self, "Tom", 0); err == nil || gee.Cached("Tom") {
+		t.Fatal("expect an unsigned push rejected")
+	}
+	if err := push(signed, "http://other", "Tom", 0); err == nil || gee.Cached("Tom") {
+		t.Fatal("expect a push for a key this node does not own rejected")
+	}
+	// 本节点已经见过版本5的失效事件，之前开始的加载推送过来的值已经过期
+	gee.invalidate("Jack", false)
+	gee.versions.observe("Jack", 5)
+	if err := push(signed, self, "Jack", 4); err != nil || gee.Cached("Jack") {
+		t.Fatalf("expect a push loaded before the invalidation dropped, got %v", err)
+	}
+	if err := push(signed, self, "Jack", 5); err != nil || !gee.Cached("Jack") {
+		t.Fatalf("expect a push loaded after the invalidation cached, got %v", err)
+	}
+	// 接受的推送推进本节点的版本号
+	if err := push(signed, self, "Tom", 9); err != nil || !gee.Cached("Tom") || gee.versions.load("Tom") < 9 {
+		t.Fatalf("expect the push cached and its version observed, got %v", err)
+	}
+}
+
+func TestShutdownWaitsForLoads(t *testing.T) {
+	release := make(chan struct{})
+	var finished int32
+	gee := NewGroup("shutdown", GetterFunc(
+		func(key string) ([]byte, error) {
+			<-release
+			atomic.StoreInt32(&finished, 1)
+			return []byte(key), nil
+		}), 2<<10)
+	pool := NewHTTPPool("")
+	gee.RegisterPeers(pool)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- pool.Serve(l, nil) }()
+
+	go gee.Get("Tom")
+	for gee.loader.InFlight() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// 加载未结束时，超时的Shutdown应当返回错误
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := pool.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expect deadline exceeded, got %v", err)
+	}
+	if err := <-served; err != http.ErrServerClosed {
+		t.Fatalf("expect server closed, got %v", err)
+	}
+
+	close(release)
+	if err := pool.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(&finished) != 1 {
+		t.Fatal("Shutdown returned before the in-flight load finished")
+	}
+}
+
+func TestShutdownBeforeServe(t *testing.T) {
+	pool := NewHTTPPool("")
+	if err := pool.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Serve在Shutdown之后才开始时不应一直运行下去
+	served := make(chan error, 1)
+	go func() { served <- pool.Serve(l, nil) }()
+	select {
+	case err := <-served:
+		if err != http.ErrServerClosed {
+			t.Fatalf("expect server closed, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Serve kept running after Shutdown")
+	}
+	if _, err := net.Dial("tcp", l.Addr().String()); err == nil {
+		t.Fatal("expect the listener closed")
+	}
+}
+
+func TestOverloadedIs503(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	gee := NewGroupOpts("overloaded", GetterFunc(
+		func(key string) ([]byte, error) {
+			<-release
+			return []byte(key), nil
+		}), 2<<10, &GroupOptions{MaxConcurrentLoads: 1})
+	go gee.Get("busy")
+	for len(gee.limiter.slots) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	srv := httptest.NewServer(NewHTTPPool(""))
+	defer srv.Close()
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath, client: http.DefaultClient}
+	err := getter.Get(&pb.Request{Group: "overloaded", Key: "Tom"}, &pb.Response{})
+	if !errors.Is(err, ErrOverloaded) {
+		t.Fatalf("expect ErrOverloaded from a 503, got %v", err)
+	}
+}
+
+func TestErrorsAcrossPeers(t *testing.T) {
+	NewGroup("missing", GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+		}), 2<<10)
+	srv := httptest.NewServer(NewHTTPPool(""))
+	defer srv.Close()
+	getter := &httpGetter{
+		baseURL: srv.URL + defaultBasePath,
+		client:  http.DefaultClient,
+		breaker: newBreaker(&HTTPPoolOptions{BreakerMinRequests: 1}, nil),
+	}
+
+	err := getter.Get(&pb.Request{Group: "missing", Key: "Tom"}, &pb.Response{})
+	if !errors.Is(err, ErrNotFound) || !strings.Contains(err.Error(), "Tom") {
+		t.Fatalf("expect ErrNotFound for Tom, got %v", err)
+	}
+	err = getter.Get(&pb.Request{Group: "nope", Key: "Tom"}, &pb.Response{})
+	if !errors.Is(err, ErrNoSuchGroup) {
+		t.Fatalf("expect ErrNoSuchGroup, got %v", err)
+	}
+	// 确定的回答不应让断路器打开
+	if state := getter.breaker.State(); state != BreakerClosed {
+		t.Fatalf("expect breaker closed, got %v", state)
+	}
+}
+
+func TestNotFoundFromOwnerIsNotRetried(t *testing.T) {
+	gee := NewGroup("owner-miss", GetterFunc(
+		func(key string) ([]byte, error) {
+			t.Fatalf("unexpected local load of %s", key)
+			return nil, nil
+		}), 2<<10)
+	gee.RegisterPeers(fakePicker{&fakePeer{err: &peerError{err: ErrNotFound, msg: "missing"}}})
+	if _, err := gee.Get("Tom"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expect ErrNotFound from owner, got %v", err)
+	}
+	if n := gee.Stats.PeerErrors.Get(); n != 0 {
+		t.Fatalf("expect not-found not to count as a peer error, got %d", n)
+	}
+}
+
+func TestGetterPanic(t *testing.T) {
+	var calls int32
+	gee := NewGroup("panic", GetterFunc(
+		func(key string) ([]byte, error) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				panic("boom")
+			}
+			return []byte(db[key]), nil
+		}), 2<<10)
+
+	// getter的panic出现在调用Get的goroutine上，共享的加载随之结束
+	func() {
+		defer func() {
+			if p, ok := recover().(*singleflight.PanicError); !ok || p.Value != "boom" {
+				t.Fatalf("expect the getter's panic on the caller, got %v", p)
+			}
+		}()
+		gee.Get("Tom")
+	}()
+	if n := gee.loader.InFlight(); n != 0 {
+		t.Fatalf("expect the panicked load removed, got %d in flight", n)
+	}
+	if view, err := gee.Get("Tom"); err != nil || view.String() != "630" {
+		t.Fatalf("expect the next load to succeed, got %v %v", view, err)
+	}
+
+	// 经过HTTP时由net/http恢复panic，请求失败但进程不退出
+	gee.Purge()
+	atomic.StoreInt32(&calls, 0)
+	srv := httptest.NewUnstartedServer(NewHTTPPoolOpts("", &HTTPPoolOptions{Logger: DiscardLogger}))
+	srv.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	srv.Start()
+	defer srv.Close()
+	if res, err := http.Get(srv.URL + defaultBasePath + "panic/Tom"); err == nil {
+		res.Body.Close()
+		t.Fatalf("expect the request to fail, got %s", res.Status)
+	}
+	if view, err := gee.Get("Tom"); err != nil || view.String() != "630" {
+		t.Fatalf("expect the next load to succeed, got %v %v", view, err)
+	}
+}
@@ -0,0 +1,367 @@
+package geeCache
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	pb "geeCache/geecachepb"
+	"google.golang.org/protobuf/proto"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	invalidatePath           = "_invalidate"
+	defaultInvalidateRetries = 3
+	defaultInvalidateBackoff = 100 * time.Millisecond
+	defaultInvalidateTimeout = time.Second
+	invalidateDedupWindow    = 5 * time.Minute
+
+	// headerVersion 接收方处理失效事件后key的版本号
+	headerVersion = "X-Geecache-Version"
+)
+
+// Invalidate drops key of group from the local cache and from the cache
+// of every peer in the peer list, owners and non-owners alike. The key's
+// owner is notified first and issues a new version of the key; the other
+// peers are then notified in parallel with that version and drop values
+// pushed from loads that started before it. Each delivery attempt is
+// bounded by InvalidateTimeout and failed ones are retried with
+// exponential backoff. The owner and the other peers are reached one after
+// the other, so with the default options Invalidate returns within about
+// 2 × (4 × 1s + 700ms) = 9.4s, or when ctx is done; the error names the
+// peers that could not be reached.
+func (p *HTTPPool) Invalidate(ctx context.Context, group, key string) error {
+	return p.publish(ctx, &pb.InvalidateRequest{Group: group, Key: key})
+}
+
+// InvalidatePrefix is like Invalidate, but drops every key of group that
+// starts with prefix. It broadcasts twice instead of notifying an owner
+// first, within the same bound.
+func (p *HTTPPool) InvalidatePrefix(ctx context.Context, group, prefix string) error {
+	return p.publish(ctx, &pb.InvalidateRequest{Group: group, Key: prefix, Prefix: true})
+}
+
+// publish 在本地应用失效事件，并广播给所有其他节点。
+//
+// 失效事件带着owner分配的版本号，其他节点据此丢弃在失效之前开始加载的推送。
+// 单个key的事件先同步发给key的owner，由它分配版本号，再带着版本号广播；
+// owner不可达时由本节点分配。前缀事件涉及所有owner，先广播一次，由每个节点
+// 推进所有分段的版本号，再带着其中最大的版本号广播第二次，并再次删除数据，
+// 两次广播之间被接受的过期推送也会被删除
+func (p *HTTPPool) publish(ctx context.Context, req *pb.InvalidateRequest) error {
+	req.Id = newEventID()
+	p.dedup.firstSeen(req.Id, time.Now())
+
+	p.mu.Lock()
+	getters := make(map[string]*httpGetter, len(p.httpGetters))
+	for peer, h := range p.httpGetters {
+		if peer != p.self {
+			getters[peer] = h
+		}
+	}
+	var owner string
+	if p.peers != nil && !req.GetPrefix() {
+		owner = p.peers.Get(req.GetKey())
+	}
+	p.mu.Unlock()
+
+	failed := make(map[string]error)
+	if h, ok := getters[owner]; ok {
+		// owner已经重试过，不再参与广播
+		delete(getters, owner)
+		version, err := p.sendInvalidation(ctx, h, req)
+		if err != nil {
+			failed[owner] = err
+		}
+		req.Version = version
+	}
+	_, version := applyInvalidation(req)
+	if !req.GetPrefix() {
+		req.Version = version
+	}
+	version = p.broadcast(ctx, req, getters, failed, version)
+	if req.GetPrefix() {
+		second := &pb.InvalidateRequest{Id: newEventID(), Group: req.GetGroup(), Key: req.GetKey(), Prefix: true, Version: version}
+		p.dedup.firstSeen(second.Id, time.Now())
+		applyInvalidation(second)
+		p.broadcast(ctx, second, getters, failed, version)
+	}
+
+	if len(failed) > 0 {
+		peers := make([]string, 0, len(failed))
+		for peer, err := range failed {
+			p.logger.Warn("invalidation not delivered", "self", p.self, "peer", peer,
+				"group", req.GetGroup(), "key", req.GetKey(), "err", err)
+			peers = append(peers, peer)
+		}
+		sort.Strings(peers)
+		return fmt.Errorf("geecache: invalidation not delivered to %s", strings.Join(peers, ", "))
+	}
+	return nil
+}
+
+// broadcast 并行地把失效事件发给getters中的节点，失败的节点记录到failed中，
+// 返回各个节点回复的版本号与version中最大的一个
+func (p *HTTPPool) broadcast(ctx context.Context, req *pb.InvalidateRequest, getters map[string]*httpGetter,
+	failed map[string]error, version int64) int64 {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for peer, h := range getters {
+		wg.Add(1)
+		go func(peer string, h *httpGetter) {
+			defer wg.Done()
+			v, err := p.sendInvalidation(ctx, h, req)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				failed[peer] = err
+			} else if v > version {
+				version = v
+			}
+		}(peer, h)
+	}
+	wg.Wait()
+	return version
+}
+
+// sendInvalidation 向节点发送失效事件，每次尝试最多等待InvalidateTimeout，
+// 失败时按指数退避重试，返回节点回复的版本号
+func (p *HTTPPool) sendInvalidation(ctx context.Context, h *httpGetter, req *pb.InvalidateRequest) (int64, error) {
+	backoff := p.opts.InvalidateBackoff
+	for attempt := 0; ; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, p.opts.InvalidateTimeout)
+		version, err := h.invalidate(attemptCtx, req)
+		cancel()
+		if err == nil || attempt >= p.opts.InvalidateRetries {
+			return version, err
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return 0, ctx.Err()
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+// serveInvalidate 接收其他节点广播的失效事件
+func (p *HTTPPool) serveInvalidate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var req pb.InvalidateRequest
+	if err = proto.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// 重试可能导致同一个事件到达多次，只应用第一次，但都要回复当前的版本号
+	var version int64
+	if req.GetId() == "" || p.dedup.firstSeen(req.GetId(), time.Now()) {
+		var n int
+		n, version = applyInvalidation(&req)
+		p.logger.Debug("applied invalidation", "self", p.self, "group", req.GetGroup(),
+			"key", req.GetKey(), "prefix", req.GetPrefix(), "version", version, "dropped", n)
+	} else if group := GetGroup(req.GetGroup()); group != nil {
+		version = group.versions.current(req.GetKey(), req.GetPrefix())
+	}
+	w.Header().Set(headerVersion, strconv.FormatInt(version, 10))
+	// 本节点没有这个group时也没有需要删除的数据，同样视为成功
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// applyInvalidation 从本地缓存中删除事件对应的key，并按事件的版本号推进
+// key的版本号，事件没有版本号时由本节点分配。返回删除的数量和处理后的版本号
+func applyInvalidation(req *pb.InvalidateRequest) (dropped int, version int64) {
+	group := GetGroup(req.GetGroup())
+	if group == nil {
+		return 0, 0
+	}
+	// 先删除数据再推进版本号，交接时和数据一起读到的版本号一定早于这次失效
+	dropped = group.invalidate(req.GetKey(), req.GetPrefix())
+	return dropped, group.versions.apply(req.GetKey(), req.GetPrefix(), req.GetVersion())
+}
+
+// invalidate 把失效事件发送给节点，返回节点回复的版本号
+func (h *httpGetter) invalidate(ctx context.Context, in *pb.InvalidateRequest) (int64, error) {
+	body, err := proto.Marshal(in)
+	if err != nil {
+		return 0, err
+	}
+	req, err := h.newRequest(ctx, http.MethodPost, invalidatePath, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	res, err := h.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return 0, fmt.Errorf("server returned: %v", res.Status)
+	}
+	// 没有这个group的节点回复0
+	version, _ := strconv.ParseInt(res.Header.Get(headerVersion), 10, 64)
+	return version, nil
+}
+
+func newEventID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// eventDedup 记录一段时间内见过的事件ID
+type eventDedup struct {
+	mu        sync.Mutex
+	seen      map[string]time.Time
+	lastPrune time.Time
+}
+
+// firstSeen 记录id，并报告这是否是第一次见到它
+func (d *eventDedup) firstSeen(id string, now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.seen == nil {
+		d.seen = make(map[string]time.Time)
+	}
+	if now.Sub(d.lastPrune) > invalidateDedupWindow {
+		for id, t := range d.seen {
+			if now.Sub(t) > invalidateDedupWindow {
+				delete(d.seen, id)
+			}
+		}
+		d.lastPrune = now
+	}
+	if _, ok := d.seen[id]; ok {
+		return false
+	}
+	d.seen[id] = now
+	return true
+}
+
+// 按key分段记录失效时间，分段越多，一个key的失效影响到的其他加载越少
+const generationStripes = 256
+
+// generations 记录每个分段最近一次失效或写入的时间(UnixNano)，只增不减。
+// 加载前后比较key所在分段的值，就能知道加载期间key是否可能被修改过；
+// 按分段而不是整个group记录，一个key的失效不会让其他key的加载都无法写入缓存
+type generations [generationStripes]atomic.Int64
+
+// stripe 返回key所在的分段，使用内联的FNV-1a以免分配内存
+func stripe(key string, n uint32) uint32 {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return h % n
+}
+
+func (g *generations) load(key string) int64 {
+	return g[stripe(key, generationStripes)].Load()
+}
+
+// bump 把key所在分段的值推进到当前时间，至少加一
+func (g *generations) bump(key string) {
+	advance(&g[stripe(key, generationStripes)], time.Now().UnixNano())
+}
+
+// bumpAll 推进所有分段，用于无法确定分段的前缀失效
+func (g *generations) bumpAll() {
+	now := time.Now().UnixNano()
+	for i := range g {
+		advance(&g[i], now)
+	}
+}
+
+func advance(v *atomic.Int64, now int64) {
+	for {
+		old := v.Load()
+		next := now
+		if next <= old {
+			next = old + 1
+		}
+		if v.CompareAndSwap(old, next) {
+			return
+		}
+	}
+}
+
+// versions 按分段记录key的版本号，用于在节点之间排序失效事件、推送和交接，
+// 不依赖各个节点的时钟。版本号由key的owner在处理失效事件和写入时分配，
+// 失效事件带着版本号广播，其他节点把分段推进到该版本号；推送和交接带着
+// 加载开始时的版本号，接收方已经见过更大的版本号时丢弃它们
+type versions [generationStripes]atomic.Int64
+
+func (v *versions) load(key string) int64 {
+	return v[stripe(key, generationStripes)].Load()
+}
+
+// next 为key分配一个新的版本号
+func (v *versions) next(key string) int64 {
+	return v[stripe(key, generationStripes)].Add(1)
+}
+
+// observe 把key所在分段推进到至少version
+func (v *versions) observe(key string, version int64) {
+	raise(&v[stripe(key, generationStripes)], version)
+}
+
+// current 返回key所在分段的版本号，前缀返回所有分段中最大的版本号
+func (v *versions) current(key string, prefix bool) int64 {
+	if !prefix {
+		return v.load(key)
+	}
+	var max int64
+	for i := range v {
+		if n := v[i].Load(); n > max {
+			max = n
+		}
+	}
+	return max
+}
+
+// apply 按失效事件推进版本号，version为0时由本节点分配，返回处理后的版本号
+func (v *versions) apply(key string, prefix bool, version int64) int64 {
+	switch {
+	case !prefix && version == 0:
+		return v.next(key)
+	case !prefix:
+		v.observe(key, version)
+	case version == 0:
+		for i := range v {
+			v[i].Add(1)
+		}
+	default:
+		for i := range v {
+			raise(&v[i], version)
+		}
+	}
+	return v.current(key, prefix)
+}
+
+func raise(v *atomic.Int64, version int64) {
+	for {
+		old := v.Load()
+		if old >= version || v.CompareAndSwap(old, version) {
+			return
+		}
+	}
+}
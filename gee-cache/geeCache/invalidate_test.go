@@ -0,0 +1,233 @@
+package geeCache
+
+import (
+	"context"
+	"fmt"
+	pb "geeCache/geecachepb"
+	"google.golang.org/protobuf/proto"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestInvalidateBroadcast(t *testing.T) {
+	gee := NewGroup("invalidate", GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(db[key]), nil
+		}), 2<<10)
+	remote := httptest.NewServer(NewHTTPPool(""))
+	defer remote.Close()
+
+	// 前两次请求失败，验证重试
+	var calls int32
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) <= 2 {
+			http.Error(w, "try again", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer flaky.Close()
+
+	pool := NewHTTPPoolOpts("http://self", &HTTPPoolOptions{InvalidateBackoff: time.Millisecond, Logger: DiscardLogger})
+	pool.Set("http://self", remote.URL, flaky.URL)
+
+	gee.Get("Tom")
+	if err := pool.Invalidate(context.Background(), "invalidate", "Tom"); err != nil {
+		t.Fatal(err)
+	}
+	if gee.Cached("Tom") {
+		t.Fatal("expect Tom invalidated")
+	}
+	// 本地应用一次，remote节点(同一进程中的同一个group)应用一次
+	if n := gee.Stats.Invalidations.Get(); n != 2 {
+		t.Fatalf("expect 2 invalidations, got %d", n)
+	}
+	if n := atomic.LoadInt32(&calls); n != 3 {
+		t.Fatalf("expect the flaky peer to be retried until it succeeds, got %d calls", n)
+	}
+
+	gee.Get("Tom")
+	gee.Get("Jack")
+	if err := pool.InvalidatePrefix(context.Background(), "invalidate", "T"); err != nil {
+		t.Fatal(err)
+	}
+	if gee.Cached("Tom") || !gee.Cached("Jack") {
+		t.Fatal("expect only keys starting with T invalidated")
+	}
+
+	flaky.Close()
+	err := pool.Invalidate(context.Background(), "invalidate", "Jack")
+	if err == nil || !strings.Contains(err.Error(), flaky.URL) {
+		t.Fatalf("expect the unreachable peer reported, got %v", err)
+	}
+}
+
+func TestInvalidateTimeout(t *testing.T) {
+	// 节点收到请求后一直不回复，每次尝试都只能等到超时
+	var calls int32
+	release := make(chan struct{})
+	hung := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+	}))
+	defer hung.Close()
+	defer close(release)
+
+	pool := NewHTTPPoolOpts("http://self", &HTTPPoolOptions{InvalidateRetries: 2, InvalidateBackoff: time.Millisecond,
+		InvalidateTimeout: 20 * time.Millisecond, Logger: DiscardLogger})
+	pool.Set("http://self", hung.URL)
+
+	start := time.Now()
+	err := pool.Invalidate(context.Background(), "invalidate-timeout", "Tom")
+	if err == nil || !strings.Contains(err.Error(), hung.URL) {
+		t.Fatalf("expect the hung peer reported, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expect every attempt bounded by the timeout, took %v", elapsed)
+	}
+	if n := atomic.LoadInt32(&calls); n != 3 {
+		t.Fatalf("expect 3 attempts, got %d", n)
+	}
+}
+
+func TestInvalidateDeduplicates(t *testing.T) {
+	gee := NewGroup("invalidate-dedup", GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(db[key]), nil
+		}), 2<<10)
+	srv := httptest.NewServer(NewHTTPPool(""))
+	defer srv.Close()
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath, client: http.DefaultClient}
+
+	req := &pb.InvalidateRequest{Id: "event-1", Group: "invalidate-dedup", Key: "Tom"}
+	for i := 0; i < 2; i++ {
+		if _, err := getter.invalidate(context.Background(), req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := gee.Stats.Invalidations.Get(); n != 1 {
+		t.Fatalf("expect a resent event to be applied once, got %d", n)
+	}
+}
+
+func TestInvalidateDuringLoad(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	gee := NewGroup("invalidate-inflight", GetterFunc(
+		func(key string) ([]byte, error) {
+			close(started)
+			<-release
+			return []byte(db[key]), nil
+		}), 2<<10)
+	done := make(chan struct{})
+	go func() {
+		gee.Get("Tom")
+		close(done)
+	}()
+	<-started
+	NewHTTPPool("http://self").Invalidate(context.Background(), "invalidate-inflight", "Tom")
+	close(release)
+	<-done
+	if gee.Cached("Tom") {
+		t.Fatal("expect a value loaded before the invalidation not to be cached")
+	}
+}
+
+func TestInvalidateOtherKeyDuringLoad(t *testing.T) {
+	if stripe("Tom", generationStripes) == stripe("Jack", generationStripes) {
+		t.Skip("Tom and Jack share a generation stripe")
+	}
+	started, release := make(chan struct{}), make(chan struct{})
+	gee := NewGroup("invalidate-other", GetterFunc(
+		func(key string) ([]byte, error) {
+			close(started)
+			<-release
+			return []byte(db[key]), nil
+		}), 2<<10)
+	done := make(chan struct{})
+	go func() {
+		gee.Get("Tom")
+		close(done)
+	}()
+	<-started
+	// 其他key的失效不影响Tom的加载写入缓存
+	gee.invalidate("Jack", false)
+	close(release)
+	<-done
+	if !gee.Cached("Tom") {
+		t.Fatal("expect Tom cached despite Jack being invalidated")
+	}
+}
+
+// newInvalidateRecorder 启动一个记录收到的失效事件的节点，回复的版本号为version
+func newInvalidateRecorder(t *testing.T, version int64) (*httptest.Server, func() []*pb.InvalidateRequest) {
+	var mu sync.Mutex
+	var received []*pb.InvalidateRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		req := &pb.InvalidateRequest{}
+		if err := proto.Unmarshal(body, req); err != nil {
+			t.Error(err)
+		}
+		mu.Lock()
+		received = append(received, req)
+		mu.Unlock()
+		w.Header().Set(headerVersion, strconv.FormatInt(version, 10))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []*pb.InvalidateRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]*pb.InvalidateRequest(nil), received...)
+	}
+}
+
+func TestInvalidateVersions(t *testing.T) {
+	gee := NewGroup("invalidate-versions", GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(db[key]), nil
+		}), 2<<10)
+	owner, ownerReceived := newInvalidateRecorder(t, 42)
+	other, otherReceived := newInvalidateRecorder(t, 7)
+	pool := NewHTTPPoolOpts("http://self", &HTTPPoolOptions{Logger: DiscardLogger})
+	pool.Set("http://self", owner.URL, other.URL)
+	var key string
+	for i := 0; key == ""; i++ {
+		if k := fmt.Sprintf("key%d", i); pool.Owners(k)[0] == owner.URL {
+			key = k
+		}
+	}
+
+	// owner先分配版本号，其他节点收到带版本号的事件
+	if err := pool.Invalidate(context.Background(), "invalidate-versions", key); err != nil {
+		t.Fatal(err)
+	}
+	if got := ownerReceived(); len(got) != 1 || got[0].GetVersion() != 0 {
+		t.Fatalf("expect the owner asked to issue a version, got %v", got)
+	}
+	if got := otherReceived(); len(got) != 1 || got[0].GetVersion() != 42 {
+		t.Fatalf("expect the owner's version broadcast, got %v", got)
+	}
+	if v := gee.versions.load(key); v != 42 {
+		t.Fatalf("expect the local version advanced to 42, got %d", v)
+	}
+
+	// 前缀事件广播两次，第二次带着所有节点中最大的版本号
+	if err := pool.InvalidatePrefix(context.Background(), "invalidate-versions", "key"); err != nil {
+		t.Fatal(err)
+	}
+	got := otherReceived()[1:]
+	if len(got) != 2 || got[0].GetVersion() != 0 || got[1].GetVersion() < 42 || got[0].GetId() == got[1].GetId() {
+		t.Fatalf("expect the prefix event sent twice, the second with the largest version, got %v", got)
+	}
+	if v := gee.versions.load("anything"); v != got[1].GetVersion() {
+		t.Fatalf("expect every stripe advanced to %d, got %d", got[1].GetVersion(), v)
+	}
+}
@@ -0,0 +1,62 @@
+package geeCache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// loadLimiter 限制同时调用 Getter 的数量，超出的请求最多排队 maxQueue 个
+type loadLimiter struct {
+	slots    chan struct{}
+	waiting  int64 // 正在排队的请求数
+	maxQueue int64
+	timeout  time.Duration // 排队的最长时间，0表示一直等待
+}
+
+// newLoadLimiter 返回nil表示不限制
+func newLoadLimiter(maxConcurrent, maxQueue int, timeout time.Duration) *loadLimiter {
+	if maxConcurrent <= 0 {
+		return nil
+	}
+	return &loadLimiter{
+		slots:    make(chan struct{}, maxConcurrent),
+		maxQueue: int64(maxQueue),
+		timeout:  timeout,
+	}
+}
+
+// acquire 获取一个加载名额，队列已满或等待超时时返回 ErrOverloaded
+func (l *loadLimiter) acquire() error {
+	if l == nil {
+		return nil
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	if atomic.AddInt64(&l.waiting, 1) > l.maxQueue {
+		atomic.AddInt64(&l.waiting, -1)
+		return ErrOverloaded
+	}
+	defer atomic.AddInt64(&l.waiting, -1)
+	if l.timeout <= 0 {
+		l.slots <- struct{}{}
+		return nil
+	}
+	timer := time.NewTimer(l.timeout)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return ErrOverloaded
+	}
+}
+
+func (l *loadLimiter) release() {
+	if l != nil {
+		<-l.slots
+	}
+}
@@ -0,0 +1,35 @@
+package geeCache
+
+import (
+	"log/slog"
+	"os"
+)
+
+// Logger is the leveled, structured logger used by groups and pools.
+// args are alternating keys and values, as with log/slog; a *slog.Logger
+// satisfies Logger.
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// defaultLogger 只输出警告和错误，每个请求的日志需要配置Debug级别才能看到
+var defaultLogger = NewLogger(slog.LevelWarn)
+
+// NewLogger returns a Logger writing text to stderr at the given minimum
+// level, e.g. slog.LevelDebug to see every request.
+func NewLogger(level slog.Level) Logger {
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+}
+
+// DiscardLogger is a Logger that drops everything.
+var DiscardLogger Logger = discardLogger{}
+
+type discardLogger struct{}
+
+func (discardLogger) Debug(msg string, args ...interface{}) {}
+func (discardLogger) Info(msg string, args ...interface{})  {}
+func (discardLogger) Warn(msg string, args ...interface{})  {}
+func (discardLogger) Error(msg string, args ...interface{}) {}
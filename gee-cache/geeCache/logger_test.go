@@ -0,0 +1,32 @@
+package geeCache
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestGroupLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	gee := NewGroupOpts("logged", GetterFunc(func(key string) ([]byte, error) {
+		return []byte(db[key]), nil
+	}), 2<<10, &GroupOptions{Logger: logger})
+	gee.Get("Tom")
+	gee.Get("Tom")
+	if out := buf.String(); !strings.Contains(out, `msg="cache hit" group=logged key=Tom`) {
+		t.Fatalf("expect a structured cache hit log, got %q", out)
+	}
+
+	buf.Reset()
+	quiet := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	gee = NewGroupOpts("quiet", GetterFunc(func(key string) ([]byte, error) {
+		return []byte(db[key]), nil
+	}), 2<<10, &GroupOptions{Logger: quiet})
+	gee.Get("Tom")
+	gee.Get("Tom")
+	if buf.Len() != 0 {
+		t.Fatalf("expect no logs below warn level, got %q", buf.String())
+	}
+}
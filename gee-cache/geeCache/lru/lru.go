@@ -2,13 +2,21 @@ package lru
 
 import (
 	"container/list"
+	"unsafe"
 )
 
 type entry struct {
 	key   string
 	value Value
+	size  int64 // 加入时计入nbytes的大小，删除时原样减去
 }
 
+// EntryOverhead is the memory the cache itself uses for each entry, on top
+// of the key and the value: the list element, the entry and its slot in
+// the map. It is an estimate for 64-bit platforms.
+var EntryOverhead = AllocSize(unsafe.Sizeof(list.Element{})) + AllocSize(unsafe.Sizeof(entry{})) +
+	MapEntrySize(unsafe.Sizeof("")+unsafe.Sizeof(&list.Element{}))
+
 // Value Len()返回所占用的内存大小
 type Value interface {
 	Len() int
@@ -18,8 +26,10 @@ type Value interface {
 type Cache struct {
 	// 允许使用的最大内存
 	maxBytes int64
-	// 当前已经使用的内存
+	// 当前已经使用的内存，包括每个条目的 EntryOverhead
 	nbytes int64
+	// 允许保存的最大条目数，为0表示不限制
+	MaxEntries int
 	// 双向链表list.List
 	ll *list.List
 	// 字典map
@@ -47,20 +57,25 @@ func (c *Cache) Get(key string) (Value, bool) {
 	return nil, false
 }
 
+// Peek returns the value of key without updating its recency.
+func (c *Cache) Peek(key string) (Value, bool) {
+	if ele, ok := c.mp[key]; ok {
+		return ele.Value.(*entry).value, true
+	}
+	return nil, false
+}
+
+// Contains reports whether key is in the cache, without updating its recency.
+func (c *Cache) Contains(key string) bool {
+	_, ok := c.mp[key]
+	return ok
+}
+
 func (c *Cache) RemoveOldest() {
 	// 取队尾节点，即最近最少访问的节点
 	if ele := c.ll.Back(); ele != nil {
-		kv := ele.Value.(*entry)
-		// 从链表中删除该节点
-		c.ll.Remove(ele)
-		// 从字典cache中删除节点映射关系
-		delete(c.mp, kv.key)
-		// 更新当前所用内存
-		c.nbytes -= int64(len(kv.key)) + int64(kv.value.Len())
-		// 若回调函数不为nil，调用回调函数
-		if c.OnEvicted != nil {
-			c.OnEvicted(kv.key, kv.value)
-		}
+		// 从链表和字典中删除该节点，更新所用内存并调用回调函数
+		c.removeElement(ele)
 	}
 }
 
@@ -70,20 +85,101 @@ func (c *Cache) Add(key string, value Value) {
 		// 若key已存在，修改
 		c.ll.MoveToFront(ele)
 		kv := ele.Value.(*entry)
-		c.nbytes += int64(value.Len()) - int64(kv.value.Len())
-		kv.value = value
+		size := entrySize(key, value)
+		c.nbytes += size - kv.size
+		kv.value, kv.size = value, size
 	} else {
 		// 若key不存在，新增
-		ele := c.ll.PushFront(&entry{key, value})
-		c.mp[key] = ele
-		c.nbytes += int64(len(key)) + int64(value.Len())
+		kv := &entry{key: key, value: value, size: entrySize(key, value)}
+		c.mp[key] = c.ll.PushFront(kv)
+		c.nbytes += kv.size
 	}
 
-	for c.maxBytes != 0 && c.nbytes > c.maxBytes {
+	for (c.maxBytes != 0 && c.nbytes > c.maxBytes) || (c.MaxEntries != 0 && c.ll.Len() > c.MaxEntries) {
 		c.RemoveOldest()
 	}
 }
 
+// entrySize 估计一个条目占用的全部内存
+func entrySize(key string, value Value) int64 {
+	return EntrySize(EntryOverhead, key, value)
+}
+
 func (c *Cache) Len() int {
 	return c.ll.Len()
 }
+
+// Keys returns the keys in the cache from the oldest to the newest.
+func (c *Cache) Keys() []string {
+	keys := make([]string, 0, c.ll.Len())
+	for ele := c.ll.Back(); ele != nil; ele = ele.Prev() {
+		keys = append(keys, ele.Value.(*entry).key)
+	}
+	return keys
+}
+
+// Range calls fn for each entry from the oldest to the newest, without
+// updating recency. Iteration stops when fn returns false.
+func (c *Cache) Range(fn func(key string, value Value) bool) {
+	for ele := c.ll.Back(); ele != nil; ele = ele.Prev() {
+		kv := ele.Value.(*entry)
+		if !fn(kv.key, kv.value) {
+			return
+		}
+	}
+}
+
+// Remove removes the provided key from the cache.
+func (c *Cache) Remove(key string) bool {
+	if ele, ok := c.mp[key]; ok {
+		c.removeElement(ele)
+		return true
+	}
+	return false
+}
+
+func (c *Cache) removeElement(ele *list.Element) {
+	kv := ele.Value.(*entry)
+	// 从链表中删除该节点
+	c.ll.Remove(ele)
+	// 从字典cache中删除节点映射关系
+	delete(c.mp, kv.key)
+	// 更新当前所用内存
+	c.nbytes -= kv.size
+	// 若回调函数不为nil，调用回调函数
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
+	}
+}
+
+// Bytes returns the memory currently used by the cache, including the
+// per-entry overhead.
+func (c *Cache) Bytes() int64 {
+	return c.nbytes
+}
+
+// Resize changes the memory limit to maxBytes, 0 meaning no limit, and
+// evicts the oldest entries until the cache fits. It returns the number
+// of entries evicted.
+func (c *Cache) Resize(maxBytes int64) int {
+	c.maxBytes = maxBytes
+	n := 0
+	for c.maxBytes != 0 && c.nbytes > c.maxBytes {
+		c.RemoveOldest()
+		n++
+	}
+	return n
+}
+
+// Purge removes all entries, calling OnEvicted for each of them.
+func (c *Cache) Purge() {
+	if c.OnEvicted != nil {
+		for ele := c.ll.Back(); ele != nil; ele = ele.Prev() {
+			kv := ele.Value.(*entry)
+			c.OnEvicted(kv.key, kv.value)
+		}
+	}
+	c.ll.Init()
+	c.mp = make(map[string]*list.Element)
+	c.nbytes = 0
+}
@@ -1,7 +1,9 @@
 package lru
 
 import (
+	"fmt"
 	"reflect"
+	"runtime"
 	"testing"
 )
 
@@ -11,6 +13,11 @@ func (d String) Len() int {
 	return len(d)
 }
 
+// size 返回条目在缓存中计入的大小
+func size(key, value string) int64 {
+	return entrySize(key, String(value))
+}
+
 func TestGet(t *testing.T) {
 	lru := NewCache(int64(0), nil)
 	lru.Add("key1", String("1234"))
@@ -25,8 +32,8 @@ func TestGet(t *testing.T) {
 func TestRemoveoldest(t *testing.T) {
 	k1, k2, k3 := "key1", "key2", "k3"
 	v1, v2, v3 := "value1", "value2", "v3"
-	cap := len(k1 + k2 + v1 + v2)
-	lru := NewCache(int64(cap), nil)
+	cap := size(k1, v1) + size(k2, v2)
+	lru := NewCache(cap, nil)
 	lru.Add(k1, String(v1))
 	lru.Add(k2, String(v2))
 	lru.Add(k3, String(v3))
@@ -41,7 +48,7 @@ func TestOnEvicted(t *testing.T) {
 	callback := func(key string, value Value) {
 		keys = append(keys, key)
 	}
-	lru := NewCache(int64(10), callback)
+	lru := NewCache(size("k2", "k2")+size("k3", "k3"), callback)
 	lru.Add("key1", String("123456"))
 	lru.Add("k2", String("k2"))
 	lru.Add("k3", String("k3"))
@@ -59,7 +66,152 @@ func TestAdd(t *testing.T) {
 	lru.Add("key", String("1"))
 	lru.Add("key", String("111"))
 
-	if lru.nbytes != int64(len("key")+len("111")) {
-		t.Fatal("expected 6 but got", lru.nbytes)
+	if expect := size("key", "111"); lru.nbytes != expect {
+		t.Fatalf("expected %d but got %d", expect, lru.nbytes)
+	}
+}
+
+func TestRange(t *testing.T) {
+	lru := NewCache(int64(0), nil)
+	lru.Add("k1", String("1"))
+	lru.Add("k2", String("2"))
+	lru.Add("k3", String("3"))
+	lru.Get("k1")
+
+	keys := make([]string, 0)
+	lru.Range(func(key string, value Value) bool {
+		keys = append(keys, key)
+		return len(keys) < 2
+	})
+	if expect := []string{"k2", "k3"}; !reflect.DeepEqual(expect, keys) {
+		t.Fatalf("expect %v, got %v", expect, keys)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	lru := NewCache(int64(0), nil)
+	lru.Add("key1", String("1234"))
+	lru.Add("k2", String("k2"))
+
+	if !lru.Remove("key1") || lru.Remove("key1") {
+		t.Fatal("Remove key1 failed")
+	}
+	if _, ok := lru.Get("key1"); ok || lru.Len() != 1 || lru.Bytes() != size("k2", "k2") {
+		t.Fatalf("expect only k2 left, got len %d bytes %d", lru.Len(), lru.Bytes())
+	}
+}
+
+func TestMaxEntries(t *testing.T) {
+	lru := NewCache(0, nil)
+	lru.MaxEntries = 2
+	lru.Add("k1", String("1"))
+	lru.Add("k2", String("2"))
+	lru.Add("k3", String("3"))
+	if _, ok := lru.Get("k1"); ok || lru.Len() != 2 {
+		t.Fatalf("expect k1 evicted by MaxEntries, got len %d", lru.Len())
+	}
+}
+
+// TestMemoryAccounting 比较配置的内存上限和实际增长的堆内存，
+// 大量小条目时每个条目的额外开销不能被忽略
+func TestMemoryAccounting(t *testing.T) {
+	const maxBytes = 8 << 20
+	keys := make([]string, 200000)
+	values := make([]String, len(keys))
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key%08d", i)
+		values[i] = String(fmt.Sprintf("%08d", i))
+	}
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	lru := NewCache(maxBytes, nil)
+	for i := range keys {
+		lru.Add(keys[i], values[i])
+	}
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+
+	// key和value本身预先分配，不计入增长
+	var data int64
+	lru.Range(func(key string, value Value) bool {
+		data += int64(len(key) + value.Len())
+		return true
+	})
+	growth := int64(after.HeapAlloc) - int64(before.HeapAlloc) + data
+	t.Logf("entries %d, accounted %d bytes, heap growth %d bytes", lru.Len(), lru.Bytes(), growth)
+	if lru.Len() == len(keys) {
+		t.Fatal("expect the cache to evict entries")
+	}
+	if growth > maxBytes*11/10 || growth < maxBytes*9/10 {
+		t.Fatalf("heap grew by %d bytes for a cache of %d bytes", growth, maxBytes)
+	}
+	runtime.KeepAlive(keys)
+	runtime.KeepAlive(values)
+}
+
+func TestPeek(t *testing.T) {
+	lru := NewCache(size("k1", "1")+size("k2", "2"), nil)
+	lru.Add("k1", String("1"))
+	lru.Add("k2", String("2"))
+	if v, ok := lru.Peek("k1"); !ok || v.(String) != "1" {
+		t.Fatalf("expect to peek k1=1, got %v %v", v, ok)
+	}
+	// Peek 不更新访问顺序，k1 仍然最先被淘汰
+	lru.Add("k3", String("3"))
+	if lru.Contains("k1") || !lru.Contains("k2") || !lru.Contains("k3") {
+		t.Fatalf("expect k1 evicted, got keys %v", lru.Keys())
+	}
+	if _, ok := lru.Peek("k1"); ok {
+		t.Fatal("expect peek of an evicted key to miss")
+	}
+}
+
+func TestKeys(t *testing.T) {
+	lru := NewCache(0, nil)
+	lru.Add("k1", String("1"))
+	lru.Add("k2", String("2"))
+	lru.Add("k3", String("3"))
+	lru.Get("k1")
+	if expect := []string{"k2", "k3", "k1"}; !reflect.DeepEqual(expect, lru.Keys()) {
+		t.Fatalf("expect %v, got %v", expect, lru.Keys())
+	}
+}
+
+func TestResize(t *testing.T) {
+	lru := NewCache(0, nil)
+	lru.Add("k1", String("1"))
+	lru.Add("k2", String("2"))
+	lru.Add("k3", String("3"))
+	if n := lru.Resize(size("k3", "3")); n != 2 || !reflect.DeepEqual(lru.Keys(), []string{"k3"}) {
+		t.Fatalf("expect 2 evicted leaving k3, got %d %v", n, lru.Keys())
+	}
+	lru.Add("k4", String("4"))
+	if lru.Len() != 1 {
+		t.Fatalf("expect the new limit to hold, got len %d", lru.Len())
+	}
+	if n := lru.Resize(0); n != 0 {
+		t.Fatalf("expect no evictions when unlimited, got %d", n)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	var evicted []string
+	lru := NewCache(0, func(key string, value Value) {
+		evicted = append(evicted, key)
+	})
+	lru.Add("k1", String("1"))
+	lru.Add("k2", String("2"))
+	lru.Purge()
+	if lru.Len() != 0 || lru.Bytes() != 0 || lru.Contains("k1") {
+		t.Fatalf("expect empty cache, got len %d bytes %d", lru.Len(), lru.Bytes())
+	}
+	if expect := []string{"k1", "k2"}; !reflect.DeepEqual(expect, evicted) {
+		t.Fatalf("expect OnEvicted for %v, got %v", expect, evicted)
+	}
+	lru.Add("k3", String("3"))
+	if lru.Len() != 1 {
+		t.Fatal("expect the cache usable after Purge")
 	}
 }
@@ -0,0 +1,58 @@
+package lru
+
+import (
+	"reflect"
+	"sync"
+)
+
+// 以下函数估计缓存条目占用的内存，lru、clock和arena包共用同一套估算方法
+
+// EntrySize estimates the memory an entry of a cache takes: overhead, the
+// memory the cache itself uses for each entry, plus the key and the value.
+// A value that is not a pointer is copied to the heap when it is stored in
+// an interface; the copy is counted too.
+func EntrySize(overhead int64, key string, value Value) int64 {
+	return overhead + int64(len(key)) + int64(value.Len()) + boxSize(value)
+}
+
+// MapEntrySize estimates the memory a map uses per entry when a key and
+// its element take slotSize bytes.
+func MapEntrySize(slotSize uintptr) int64 {
+	// 除了槽位本身，还有控制字节、空闲的槽位以及反复删除留下的墓碑。
+	// map按倍数扩容，实测在槽位大小的2到3倍之间，取2.75倍
+	return int64(11 * slotSize / 4)
+}
+
+// AllocSize estimates the memory a heap allocation of n bytes takes,
+// rounded up to the allocator's size class.
+func AllocSize(n uintptr) int64 {
+	// 128字节以内的size class除了8和24都是16的倍数，更大的对象也按16字节对齐估算
+	switch {
+	case n == 0:
+		return 0
+	case n <= 8:
+		return 8
+	case n > 16 && n <= 24:
+		return 24
+	}
+	return int64((n + 15) &^ 15)
+}
+
+// boxSizes 缓存每种value类型的 boxSize，reflect.Type -> int64
+var boxSizes sync.Map
+
+// boxSize 返回value保存到接口中时在堆上的拷贝占用的内存，指针类型为0
+func boxSize(value Value) int64 {
+	t := reflect.TypeOf(value)
+	if size, ok := boxSizes.Load(t); ok {
+		return size.(int64)
+	}
+	var size int64
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Chan, reflect.Func, reflect.UnsafePointer:
+	default:
+		size = AllocSize(t.Size())
+	}
+	boxSizes.Store(t, size)
+	return size
+}
@@ -1,6 +1,9 @@
 package geeCache
 
-import pb "geeCache/geecachepb"
+import (
+	"context"
+	pb "geeCache/geecachepb"
+)
 
 type PeerPicker interface {
 	PickPeer(key string) (peer PeerGetter, ok bool)
@@ -9,3 +12,32 @@ type PeerPicker interface {
 type PeerGetter interface {
 	Get(in *pb.Request, out *pb.Response) error
 }
+
+// ContextPeerGetter is implemented by a PeerGetter whose requests can be
+// cancelled and traced through a context. Groups call GetContext instead
+// of Get when a peer implements it.
+type ContextPeerGetter interface {
+	GetContext(ctx context.Context, in *pb.Request, out *pb.Response) error
+}
+
+// ReplicaPicker is implemented by a PeerPicker that keeps more than one
+// copy of each key.
+type ReplicaPicker interface {
+	// PickPeers returns the owners of key in ring order, primary first.
+	// A nil entry stands for the local node.
+	PickPeers(key string) []PeerGetter
+}
+
+// PeerSetter is implemented by a PeerGetter that accepts writes for the
+// keys it owns.
+type PeerSetter interface {
+	Set(ctx context.Context, in *pb.Request, value []byte) error
+}
+
+// PeerPusher is implemented by a PeerGetter that accepts values pushed
+// to it by the node that loaded them. version is the key's version on
+// that node when the load started; peers that have seen a newer version
+// of the key drop the value.
+type PeerPusher interface {
+	Push(in *pb.Request, value []byte, version int64) error
+}
@@ -0,0 +1,50 @@
+package geeCache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// rateLimiter 以固定的间隔放行请求，用来保护对端或数据源
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// newRateLimiter 返回每秒最多放行perSecond次的限流器，perSecond<=0时不限流
+func newRateLimiter(perSecond int) *rateLimiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	return &rateLimiter{interval: time.Second / time.Duration(perSecond)}
+}
+
+// wait 阻塞直到下一次放行或ctx结束，nil限流器直接返回
+func (l *rateLimiter) wait(ctx context.Context) error {
+	return l.waitN(ctx, 1)
+}
+
+// waitN 一次性申请n次放行
+func (l *rateLimiter) waitN(ctx context.Context, n int) error {
+	if l == nil {
+		return ctx.Err()
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(l.interval * time.Duration(n))
+	at := l.next.Add(-l.interval)
+	l.mu.Unlock()
+	timer := time.NewTimer(time.Until(at))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,129 @@
+package geeCache
+
+import (
+	"context"
+	"geeCache/consistentHash"
+	"net"
+	"net/http"
+	"time"
+)
+
+// 等待进行中的加载结束时的轮询间隔
+const shutdownPollInterval = 10 * time.Millisecond
+
+// ListenAndServe listens on addr and serves handler until Shutdown is
+// called. A nil handler serves the pool itself. TLS is used when the
+// pool was created with a TLSConfig.
+func (p *HTTPPool) ListenAndServe(addr string, handler http.Handler) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return p.Serve(l, handler)
+}
+
+// Serve serves handler on l until Shutdown is called. If Shutdown has
+// already been called, it closes l and returns http.ErrServerClosed.
+func (p *HTTPPool) Serve(l net.Listener, handler http.Handler) error {
+	if handler == nil {
+		handler = p
+	}
+	// 在锁内登记服务，Shutdown要么看到它，要么已经先执行完，不会漏掉
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		l.Close()
+		return http.ErrServerClosed
+	}
+	srv := &http.Server{Handler: handler, TLSConfig: p.opts.TLSConfig}
+	p.server = srv
+	p.mu.Unlock()
+	if srv.TLSConfig != nil {
+		return srv.ServeTLS(l, "", "")
+	}
+	return srv.Serve(l)
+}
+
+// Shutdown gracefully stops the pool: it stops accepting new requests,
+// waits for in-flight peer requests and for in-flight loads of the groups
+// served by this pool, flushes their write-behind queues, optionally hands
+// their data off to the remaining peers, and then returns. It returns ctx's error if ctx is done first.
+func (p *HTTPPool) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	srv := p.server
+	p.closed = true
+	p.mu.Unlock()
+	// (1) 不再接受新的请求，并等待处理中的请求结束
+	if srv != nil {
+		if err := srv.Shutdown(ctx); err != nil {
+			return err
+		}
+	}
+	// (2) 等待本节点发起的加载结束
+	if err := p.waitLoads(ctx); err != nil {
+		return err
+	}
+	// (3) 把write-behind队列中的写入刷到数据源
+	for _, g := range p.groups() {
+		if err := g.Flush(ctx); err != nil {
+			return err
+		}
+	}
+	// (4) 把本节点的数据交给接管它们的节点
+	if p.opts.HandoffOnShutdown {
+		p.handoffAll(ctx)
+	}
+	return ctx.Err()
+}
+
+// groups 返回使用本节点列表的所有group
+func (p *HTTPPool) groups() []*Group {
+	var gs []*Group
+	for _, g := range allGroups() {
+		if g.peers == PeerPicker(p) {
+			gs = append(gs, g)
+		}
+	}
+	return gs
+}
+
+func (p *HTTPPool) waitLoads(ctx context.Context) error {
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		inflight := 0
+		for _, g := range p.groups() {
+			inflight += g.loader.InFlight() + g.fwdLoader.InFlight()
+		}
+		if inflight == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			p.logger.Warn("shutdown with loads in flight", "self", p.self, "loads", inflight)
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// handoffAll 假设本节点已经离开哈希环，把数据交给剩下的节点
+func (p *HTTPPool) handoffAll(ctx context.Context) {
+	p.handoffMu.Lock()
+	defer p.handoffMu.Unlock()
+	p.mu.Lock()
+	oldRing, getters := p.peers, p.httpGetters
+	var rest []string
+	for _, peer := range p.peerList {
+		if peer != p.self {
+			rest = append(rest, peer)
+		}
+	}
+	p.mu.Unlock()
+	if oldRing == nil || len(rest) == 0 {
+		return
+	}
+	newRing := consistentHash.New(p.opts.Replicas, nil)
+	newRing.Add(rest...)
+	p.handoff(ctx, oldRing, newRing, getters)
+}
@@ -1,6 +1,10 @@
 package singleflight
 
-import "sync"
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+)
 
 // 正在进行中、或者已经结束的请求
 type call struct {
@@ -15,27 +19,96 @@ type Group struct {
 	mp map[string]*call
 }
 
+// PanicError 表示 fn 发生了panic。Do 在所有等待者的goroutine上重新panic，
+// DoChan 把它作为 Result.Err 返回，由调用方决定是否重新panic
+type PanicError struct {
+	Value interface{} // recover() 得到的值
+	Stack []byte      // 发生panic时的调用栈
+}
+
+func (p *PanicError) Error() string {
+	return fmt.Sprintf("%v\n\n%s", p.Value, p.Stack)
+}
+
+// NewPanicError 包装recover()得到的值，v 已经是 *PanicError 时原样返回
+func NewPanicError(v interface{}) *PanicError {
+	if p, ok := v.(*PanicError); ok {
+		return p
+	}
+	return &PanicError{Value: v, Stack: debug.Stack()}
+}
+
 func (g *Group) Do(key string, fn func() (interface{}, error)) (interface{}, error) {
+	c, ok := g.join(key)
+	if ok {
+		c.wg.Wait() // 如果请求正在进行中，则等待
+	} else {
+		g.doCall(c, key, fn)
+	}
+	if p, ok := c.err.(*PanicError); ok {
+		panic(p)
+	}
+	return c.val, c.err // 请求结束，返回结果
+}
+
+// join 返回key对应的请求，ok 表示请求已经存在，否则新建的请求需要由调用方执行
+func (g *Group) join(key string) (c *call, ok bool) {
 	g.mu.Lock()
+	defer g.mu.Unlock()
 	if g.mp == nil {
 		g.mp = make(map[string]*call)
 	}
 	if c, ok := g.mp[key]; ok {
-		g.mu.Unlock()
-		c.wg.Wait()         // 如果请求正在进行中，则等待
-		return c.val, c.err // 请求结束，返回结果
+		return c, true
 	}
-	c := new(call)
+	c = new(call)
 	c.wg.Add(1)   // 发起请求前加锁
 	g.mp[key] = c // 添加到g.mp，表明key已经有对应的请求在处理
-	g.mu.Unlock()
+	return c, false
+}
 
-	c.val, c.err = fn() // 调用 fn，发起请求
-	c.wg.Done()         // 请求结束
+// doCall 调用 fn，发起请求。fn panic时也要唤醒等待者并更新g.mp，
+// panic 被记录为 *PanicError，交给各个等待者处理
+func (g *Group) doCall(c *call, key string, fn func() (interface{}, error)) {
+	defer func() {
+		if v := recover(); v != nil {
+			c.val, c.err = nil, NewPanicError(v)
+		}
+		c.wg.Done() // 请求结束
 
-	g.mu.Lock()
-	delete(g.mp, key) // 更新g.mp
-	g.mu.Unlock()
+		g.mu.Lock()
+		delete(g.mp, key) // 更新g.mp
+		g.mu.Unlock()
+	}()
+	c.val, c.err = fn()
+}
 
-	return c.val, c.err
+// Result 是 DoChan 返回的结果
+type Result struct {
+	Val interface{}
+	Err error
+}
+
+// DoChan 与 Do 相同，但不阻塞，结果从返回的channel中读取。
+// 调用方可以不再等待，fn 仍会执行完并把结果交给其他等待者。
+// fn panic时 Err 为 *PanicError，不会在执行 fn 的goroutine上panic
+func (g *Group) DoChan(key string, fn func() (interface{}, error)) <-chan Result {
+	ch := make(chan Result, 1)
+	c, ok := g.join(key)
+	go func() {
+		if ok {
+			c.wg.Wait()
+		} else {
+			g.doCall(c, key, fn)
+		}
+		ch <- Result{Val: c.val, Err: c.err}
+	}()
+	return ch
+}
+
+// InFlight 返回正在进行中的请求数
+func (g *Group) InFlight() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.mp)
 }
@@ -0,0 +1,83 @@
+package geeCache
+
+import (
+	"strconv"
+	"sync/atomic"
+)
+
+// An AtomicInt is an int64 to be accessed atomically.
+type AtomicInt int64
+
+// Add atomically adds n to i.
+func (i *AtomicInt) Add(n int64) {
+	atomic.AddInt64((*int64)(i), n)
+}
+
+// Get atomically gets the value of i.
+func (i *AtomicInt) Get() int64 {
+	return atomic.LoadInt64((*int64)(i))
+}
+
+func (i *AtomicInt) String() string {
+	return strconv.FormatInt(i.Get(), 10)
+}
+
+// Stats are per-group statistics.
+type Stats struct {
+	Gets           AtomicInt `json:"gets"`            // any Get request, including from peers
+	CacheHits      AtomicInt `json:"cache_hits"`      // mainCache 命中
+	HotCacheHits   AtomicInt `json:"hot_cache_hits"`  // 远程热点key的本地副本命中
+	PeerLoads      AtomicInt `json:"peer_loads"`      // 从远程节点成功获取
+	PeerErrors     AtomicInt `json:"peer_errors"`     // 访问远程节点失败
+	Loads          AtomicInt `json:"loads"`           // (gets - cacheHits)
+	LoadsDeduped   AtomicInt `json:"loads_deduped"`   // singleflight 合并之后实际的加载次数
+	LocalLoads     AtomicInt `json:"local_loads"`     // 调用 Getter 成功
+	LocalLoadErrs  AtomicInt `json:"local_load_errs"` // 调用 Getter 失败
+	LoadsShed      AtomicInt `json:"loads_shed"`      // 超过并发限制被拒绝的加载
+	ServerRequests AtomicInt `json:"server_requests"` // 来自其他节点的请求
+	HedgesFired    AtomicInt `json:"hedges_fired"`    // 发出的对冲请求
+	HedgesWon      AtomicInt `json:"hedges_won"`      // 对冲请求先于owner返回了值
+	Invalidations  AtomicInt `json:"invalidations"`   // 收到的失效事件
+	Sets           AtomicInt `json:"sets"`            // Set 调用次数
+	SetErrs        AtomicInt `json:"set_errs"`        // Set 失败
+	WriteQueue     AtomicInt `json:"write_queue"`     // write-behind 队列中等待写入的key数
+	WritesFlushed  AtomicInt `json:"writes_flushed"`  // write-behind 成功写入数据源
+	WriteRetries   AtomicInt `json:"write_retries"`   // write-behind 批次重试
+	WritesDropped  AtomicInt `json:"writes_dropped"`  // 重试用尽后丢弃的写入
+}
+
+// Snapshot returns a copy of the stats that is safe to read and marshal.
+func (s *Stats) Snapshot() Stats {
+	return Stats{
+		Gets:           AtomicInt(s.Gets.Get()),
+		CacheHits:      AtomicInt(s.CacheHits.Get()),
+		HotCacheHits:   AtomicInt(s.HotCacheHits.Get()),
+		PeerLoads:      AtomicInt(s.PeerLoads.Get()),
+		PeerErrors:     AtomicInt(s.PeerErrors.Get()),
+		Loads:          AtomicInt(s.Loads.Get()),
+		LoadsDeduped:   AtomicInt(s.LoadsDeduped.Get()),
+		LocalLoads:     AtomicInt(s.LocalLoads.Get()),
+		LocalLoadErrs:  AtomicInt(s.LocalLoadErrs.Get()),
+		LoadsShed:      AtomicInt(s.LoadsShed.Get()),
+		ServerRequests: AtomicInt(s.ServerRequests.Get()),
+		HedgesFired:    AtomicInt(s.HedgesFired.Get()),
+		HedgesWon:      AtomicInt(s.HedgesWon.Get()),
+		Invalidations:  AtomicInt(s.Invalidations.Get()),
+		Sets:           AtomicInt(s.Sets.Get()),
+		SetErrs:        AtomicInt(s.SetErrs.Get()),
+		WriteQueue:     AtomicInt(s.WriteQueue.Get()),
+		WritesFlushed:  AtomicInt(s.WritesFlushed.Get()),
+		WriteRetries:   AtomicInt(s.WriteRetries.Get()),
+		WritesDropped:  AtomicInt(s.WritesDropped.Get()),
+	}
+}
+
+// CacheStats are returned by stats accessors on Group.
+type CacheStats struct {
+	Bytes     int64 `json:"bytes"`
+	MaxBytes  int64 `json:"max_bytes"`
+	Items     int64 `json:"items"`
+	Gets      int64 `json:"gets"`
+	Hits      int64 `json:"hits"`
+	Evictions int64 `json:"evictions"`
+}
@@ -0,0 +1,239 @@
+package geeCache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const headerTraceParent = "traceparent"
+
+// Attribute is a key/value pair attached to a span.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Attr is a shorthand for creating an Attribute.
+func Attr(key string, value interface{}) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// A Tracer starts spans at each step of a request: Group.Get, picking
+// the peer, the peer request made by the HTTP client and its handling by
+// the remote ServeHTTP. Implementations must be safe for concurrent use.
+type Tracer interface {
+	// Start starts a span as a child of the span or remote span context
+	// carried by ctx, and returns a context carrying the new span.
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+// A Span is one timed step of a request. End must be called exactly once.
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	End(err error)
+	SpanContext() SpanContext
+}
+
+// SpanContext identifies a span across process boundaries.
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Sampled bool
+}
+
+// IsValid reports whether sc has non-zero trace and span IDs.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// TraceParent formats sc as a W3C traceparent header value.
+func (sc SpanContext) TraceParent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%x-%x-%s", sc.TraceID, sc.SpanID, flags)
+}
+
+// ParseTraceParent parses a W3C traceparent header value.
+func ParseTraceParent(s string) (SpanContext, error) {
+	var sc SpanContext
+	// version-traceid-parentid-flags, e.g. 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+	parts := strings.Split(s, "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return sc, errors.New("geecache: malformed traceparent")
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil || len(flags) != 1 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return sc, errors.New("geecache: malformed traceparent")
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, errors.New("geecache: malformed traceparent")
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, errors.New("geecache: malformed traceparent")
+	}
+	if !sc.IsValid() {
+		return sc, errors.New("geecache: invalid traceparent")
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, nil
+}
+
+type spanKey struct{}
+type remoteSpanKey struct{}
+
+// ContextWithSpan returns a context carrying span.
+func ContextWithSpan(ctx context.Context, span Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext returns the span carried by ctx, or nil.
+func SpanFromContext(ctx context.Context) Span {
+	span, _ := ctx.Value(spanKey{}).(Span)
+	return span
+}
+
+// ContextWithRemoteSpanContext returns a context carrying a span context
+// received from another process, to be used as the parent of new spans.
+func ContextWithRemoteSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteSpanKey{}, sc)
+}
+
+// SpanContextFromContext returns the span context of the span carried by
+// ctx, or else the remote span context carried by ctx.
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	if span := SpanFromContext(ctx); span != nil {
+		if sc := span.SpanContext(); sc.IsValid() {
+			return sc
+		}
+	}
+	sc, _ := ctx.Value(remoteSpanKey{}).(SpanContext)
+	return sc
+}
+
+// injectTraceParent 把当前的span传递给下一跳
+func injectTraceParent(ctx context.Context, h http.Header) {
+	if sc := SpanContextFromContext(ctx); sc.IsValid() {
+		h.Set(headerTraceParent, sc.TraceParent())
+	}
+}
+
+// extractTraceParent 读取上一跳传过来的span
+func extractTraceParent(ctx context.Context, h http.Header) context.Context {
+	if v := h.Get(headerTraceParent); v != "" {
+		if sc, err := ParseTraceParent(v); err == nil {
+			return ContextWithRemoteSpanContext(ctx, sc)
+		}
+	}
+	return ctx
+}
+
+// nopTracer 是默认的tracer，不记录任何东西
+type nopTracer struct{}
+
+func (nopTracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	return ctx, nopSpan{}
+}
+
+type nopSpan struct{}
+
+func (nopSpan) SetAttributes(attrs ...Attribute) {}
+func (nopSpan) End(err error)                    {}
+func (nopSpan) SpanContext() SpanContext         { return SpanContext{} }
+
+// RecordedSpan is a finished span kept by a RecordingTracer.
+type RecordedSpan struct {
+	Name       string
+	TraceID    string
+	SpanID     string
+	ParentID   string // 根span为空
+	Attributes map[string]interface{}
+	Err        error
+	Start      time.Time
+	End        time.Time
+}
+
+// RecordingTracer is a Tracer that keeps finished spans in memory, for tests.
+type RecordingTracer struct {
+	mu    sync.Mutex
+	spans []RecordedSpan
+}
+
+// NewRecordingTracer returns an empty RecordingTracer.
+func NewRecordingTracer() *RecordingTracer {
+	return &RecordingTracer{}
+}
+
+func (t *RecordingTracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	span := &recordingSpan{tracer: t}
+	span.rec.Name = name
+	span.rec.Start = time.Now()
+	span.rec.Attributes = make(map[string]interface{}, len(attrs))
+	span.SetAttributes(attrs...)
+
+	parent := SpanContextFromContext(ctx)
+	if parent.IsValid() {
+		span.sc.TraceID = parent.TraceID
+		span.rec.ParentID = hex.EncodeToString(parent.SpanID[:])
+	} else {
+		rand.Read(span.sc.TraceID[:])
+	}
+	rand.Read(span.sc.SpanID[:])
+	span.sc.Sampled = true
+	span.rec.TraceID = hex.EncodeToString(span.sc.TraceID[:])
+	span.rec.SpanID = hex.EncodeToString(span.sc.SpanID[:])
+	return ContextWithSpan(ctx, span), span
+}
+
+// Spans returns the finished spans in the order they ended.
+func (t *RecordingTracer) Spans() []RecordedSpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]RecordedSpan(nil), t.spans...)
+}
+
+// Reset drops the recorded spans.
+func (t *RecordingTracer) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.spans = nil
+}
+
+type recordingSpan struct {
+	tracer *RecordingTracer
+	sc     SpanContext
+	mu     sync.Mutex
+	rec    RecordedSpan
+}
+
+func (s *recordingSpan) SetAttributes(attrs ...Attribute) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, a := range attrs {
+		s.rec.Attributes[a.Key] = a.Value
+	}
+}
+
+func (s *recordingSpan) End(err error) {
+	s.mu.Lock()
+	s.rec.Err = err
+	s.rec.End = time.Now()
+	rec := s.rec
+	s.mu.Unlock()
+
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	s.tracer.spans = append(s.tracer.spans, rec)
+}
+
+func (s *recordingSpan) SpanContext() SpanContext {
+	return s.sc
+}
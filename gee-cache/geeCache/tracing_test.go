@@ -0,0 +1,100 @@
+package geeCache
+
+import (
+	"context"
+	pb "geeCache/geecachepb"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	const tp = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, err := ParseTraceParent(tp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sc.Sampled || sc.TraceParent() != tp {
+		t.Fatalf("expect %s, got %s", tp, sc.TraceParent())
+	}
+	for _, bad := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473x-00f067aa0ba902b7-01",
+	} {
+		if _, err := ParseTraceParent(bad); err == nil {
+			t.Errorf("expect error for %q", bad)
+		}
+	}
+}
+
+// renamedPeer 把请求转给另一个group，避免同一进程中的group请求自己
+type renamedPeer struct {
+	*httpGetter
+	group string
+}
+
+func (p renamedPeer) Get(in *pb.Request, out *pb.Response) error {
+	return p.GetContext(context.Background(), in, out)
+}
+
+func (p renamedPeer) GetContext(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	return p.httpGetter.GetContext(ctx, &pb.Request{Group: p.group, Key: in.Key}, out)
+}
+
+func TestTracingAcrossPeers(t *testing.T) {
+	client, server := NewRecordingTracer(), NewRecordingTracer()
+	NewGroupOpts("traced-remote", GetterFunc(func(key string) ([]byte, error) {
+		return []byte(db[key]), nil
+	}), 2<<10, &GroupOptions{Tracer: server})
+	pool := NewHTTPPoolOpts("http://remote", &HTTPPoolOptions{Tracer: server})
+	srv := httptest.NewServer(pool)
+	defer srv.Close()
+
+	local := NewHTTPPoolOpts("http://local", &HTTPPoolOptions{Tracer: client})
+	peer := renamedPeer{local.newHTTPGetter(srv.URL), "traced-remote"}
+	gee := NewGroupOpts("traced-local", GetterFunc(func(key string) ([]byte, error) {
+		t.Fatal("should load from peer")
+		return nil, nil
+	}), 2<<10, &GroupOptions{Tracer: client})
+	gee.RegisterPeers(fakePicker{peer})
+
+	if v, err := gee.Get("Tom"); err != nil || v.String() != "630" {
+		t.Fatalf("expect 630, got %q %v", v.String(), err)
+	}
+
+	spans := make(map[string]RecordedSpan)
+	for _, s := range client.Spans() {
+		spans["local "+s.Name] = s
+	}
+	for _, s := range server.Spans() {
+		spans["remote "+s.Name] = s
+	}
+	root := spans["local geecache.Group.Get"]
+	if root.ParentID != "" || root.Attributes["cache_hit"] != false {
+		t.Fatalf("unexpected root span %+v", root)
+	}
+	// 每一跳都是上一跳的子span
+	chain := []struct{ name, parent string }{
+		{"local geecache.PickPeer", "local geecache.Group.Get"},
+		{"local geecache.httpGetter.Get", "local geecache.Group.Get"},
+		{"remote geecache.ServeHTTP", "local geecache.httpGetter.Get"},
+		{"remote geecache.Group.Get", "remote geecache.ServeHTTP"},
+	}
+	for _, c := range chain {
+		s, ok := spans[c.name]
+		if !ok {
+			t.Fatalf("missing span %s", c.name)
+		}
+		if s.TraceID != root.TraceID {
+			t.Errorf("%s: expect trace %s, got %s", c.name, root.TraceID, s.TraceID)
+		}
+		if s.ParentID != spans[c.parent].SpanID {
+			t.Errorf("%s: expect parent %s", c.name, c.parent)
+		}
+	}
+	if s := spans["remote geecache.ServeHTTP"]; s.Attributes["status"] != 200 || s.Attributes["key"] != "Tom" {
+		t.Fatalf("unexpected server span %+v", s)
+	}
+}
@@ -0,0 +1,121 @@
+package geeCache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"google.golang.org/protobuf/proto"
+)
+
+// A Codec converts values of type T to and from the bytes stored in the
+// cache and sent between peers.
+type Codec[T any] interface {
+	Encode(v T) ([]byte, error)
+	Decode(data []byte) (T, error)
+}
+
+// JSONCodec encodes values with encoding/json.
+type JSONCodec[T any] struct{}
+
+func (JSONCodec[T]) Encode(v T) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec[T]) Decode(data []byte) (T, error) {
+	var v T
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
+
+// GobCodec encodes values with encoding/gob.
+type GobCodec[T any] struct{}
+
+func (GobCodec[T]) Encode(v T) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobCodec[T]) Decode(data []byte) (T, error) {
+	var v T
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&v)
+	return v, err
+}
+
+// ProtoCodec encodes protobuf messages. T is a pointer to a generated
+// message type, e.g. ProtoCodec[*geecachepb.Request].
+type ProtoCodec[T proto.Message] struct{}
+
+func (ProtoCodec[T]) Encode(v T) ([]byte, error) {
+	return proto.Marshal(v)
+}
+
+func (ProtoCodec[T]) Decode(data []byte) (T, error) {
+	// 通过零值(nil指针)的反射信息创建一个新的消息
+	var zero T
+	v := zero.ProtoReflect().New().Interface().(T)
+	err := proto.Unmarshal(data, v)
+	return v, err
+}
+
+// A TypedGetter loads the value of type T for a key.
+type TypedGetter[T any] interface {
+	Get(key string) (T, error)
+}
+
+// A TypedGetterFunc implements TypedGetter with a function.
+type TypedGetterFunc[T any] func(key string) (T, error)
+
+// Get implements TypedGetter interface function
+func (f TypedGetterFunc[T]) Get(key string) (T, error) {
+	return f(key)
+}
+
+// TypedGroup wraps a Group whose values are of type T. Values returned by
+// the getter are encoded once with the codec, stored and sent between
+// peers as bytes, and decoded again by Get.
+type TypedGroup[T any] struct {
+	group *Group
+	codec Codec[T]
+}
+
+// NewTypedGroup creates a TypedGroup and registers its underlying Group.
+func NewTypedGroup[T any](name string, getter TypedGetter[T], cacheBytes int64, codec Codec[T]) *TypedGroup[T] {
+	return NewTypedGroupOpts(name, getter, cacheBytes, codec, nil)
+}
+
+// NewTypedGroupOpts creates a TypedGroup with the given options.
+func NewTypedGroupOpts[T any](name string, getter TypedGetter[T], cacheBytes int64, codec Codec[T], o *GroupOptions) *TypedGroup[T] {
+	if getter == nil {
+		panic("nil Getter")
+	}
+	if codec == nil {
+		panic("nil Codec")
+	}
+	g := NewGroupOpts(name, GetterFunc(
+		func(key string) ([]byte, error) {
+			v, err := getter.Get(key)
+			if err != nil {
+				return nil, err
+			}
+			return codec.Encode(v)
+		}), cacheBytes, o)
+	return &TypedGroup[T]{group: g, codec: codec}
+}
+
+// Get returns the decoded value for key.
+func (g *TypedGroup[T]) Get(key string) (T, error) {
+	view, err := g.group.Get(key)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return g.codec.Decode(view.bytes())
+}
+
+// Group returns the underlying Group, e.g. to register peers.
+func (g *TypedGroup[T]) Group() *Group {
+	return g.group
+}
@@ -0,0 +1,59 @@
+package geeCache
+
+import (
+	"fmt"
+	pb "geeCache/geecachepb"
+	"reflect"
+	"testing"
+)
+
+type score struct {
+	Name  string
+	Score int
+}
+
+func scoreGetter(loads *int) TypedGetter[score] {
+	return TypedGetterFunc[score](func(key string) (score, error) {
+		*loads++
+		if v, ok := db[key]; ok {
+			var s int
+			fmt.Sscan(v, &s)
+			return score{Name: key, Score: s}, nil
+		}
+		return score{}, fmt.Errorf("%s not exist", key)
+	})
+}
+
+func TestTypedGroup(t *testing.T) {
+	codecs := map[string]Codec[score]{
+		"json": JSONCodec[score]{},
+		"gob":  GobCodec[score]{},
+	}
+	for name, codec := range codecs {
+		loads := 0
+		gee := NewTypedGroup("typed-"+name, scoreGetter(&loads), 2<<10, codec)
+		for i := 0; i < 2; i++ {
+			v, err := gee.Get("Tom")
+			if err != nil || !reflect.DeepEqual(v, score{Name: "Tom", Score: 630}) {
+				t.Fatalf("%s: expect Tom=630, got %+v %v", name, v, err)
+			}
+		}
+		if loads != 1 {
+			t.Fatalf("%s: expect 1 load, got %d", name, loads)
+		}
+		if _, err := gee.Get("unknown"); err == nil {
+			t.Fatalf("%s: expect error for unknown key", name)
+		}
+	}
+}
+
+func TestProtoCodec(t *testing.T) {
+	gee := NewTypedGroup[*pb.Request]("typed-proto", TypedGetterFunc[*pb.Request](
+		func(key string) (*pb.Request, error) {
+			return &pb.Request{Group: "scores", Key: key}, nil
+		}), 2<<10, ProtoCodec[*pb.Request]{})
+	v, err := gee.Get("Tom")
+	if err != nil || v.GetGroup() != "scores" || v.GetKey() != "Tom" {
+		t.Fatalf("unexpected value %v %v", v, err)
+	}
+}
@@ -0,0 +1,179 @@
+package geeCache
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+const defaultWarmConcurrency = 8
+
+// A KeyIterator yields the keys to warm, e.g. by scanning the origin.
+// Next returns false when there are no more keys; Err then reports why
+// the iteration stopped, or nil if it simply ran out of keys.
+type KeyIterator interface {
+	Next() (key string, ok bool)
+	Err() error
+}
+
+// SliceKeys returns a KeyIterator over keys.
+func SliceKeys(keys []string) KeyIterator {
+	return &sliceKeys{keys: keys}
+}
+
+type sliceKeys struct {
+	keys []string
+}
+
+func (s *sliceKeys) Next() (string, bool) {
+	if len(s.keys) == 0 {
+		return "", false
+	}
+	key := s.keys[0]
+	s.keys = s.keys[1:]
+	return key, true
+}
+
+func (s *sliceKeys) Err() error { return nil }
+
+// LineKeys returns a KeyIterator reading one key per line from r.
+// Surrounding spaces are trimmed and blank lines are skipped.
+func LineKeys(r io.Reader) KeyIterator {
+	return &lineKeys{s: bufio.NewScanner(r)}
+}
+
+type lineKeys struct {
+	s *bufio.Scanner
+}
+
+func (l *lineKeys) Next() (string, bool) {
+	for l.s.Scan() {
+		if key := strings.TrimSpace(l.s.Text()); key != "" {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+func (l *lineKeys) Err() error { return l.s.Err() }
+
+// WarmOptions configure a warm-up.
+type WarmOptions struct {
+	// Concurrency is the number of keys loaded at the same time.
+	// If blank, it defaults to 8.
+	Concurrency int
+	// Rate is the maximum number of keys loaded per second, protecting
+	// the origin Getter. If blank, keys are loaded as fast as possible.
+	Rate int
+	// Total is the number of keys expected, reported in WarmProgress.
+	// If blank, it is 0, meaning unknown; Warm fills it in itself.
+	Total int
+	// Progress, if non-nil, is called after every key. Calls are serialized.
+	Progress func(WarmProgress)
+}
+
+// WarmProgress reports how far a warm-up has got.
+type WarmProgress struct {
+	Done   int   `json:"done"`   // 已处理的key，包括失败的
+	Failed int   `json:"failed"` // 加载失败的key
+	Total  int   `json:"total"`  // 预计的key总数，0表示未知
+	Err    error `json:"-"`      // 最近一次失败的原因
+}
+
+// Warm loads keys into the cache, at most concurrency at a time. Each key
+// is requested like a Get, so keys owned by other peers are loaded and
+// cached by their owners. A key that fails to load is counted in
+// WarmProgress.Failed and does not stop the warm-up.
+func (g *Group) Warm(keys []string, concurrency int) WarmProgress {
+	p, _ := g.WarmFrom(context.Background(), SliceKeys(keys), &WarmOptions{
+		Concurrency: concurrency,
+		Total:       len(keys),
+	})
+	return p
+}
+
+// WarmFile warms the keys listed in the file at path, one key per line.
+func (g *Group) WarmFile(ctx context.Context, path string, opts *WarmOptions) (WarmProgress, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return WarmProgress{}, err
+	}
+	defer f.Close()
+	return g.WarmFrom(ctx, LineKeys(f), opts)
+}
+
+// WarmFrom warms every key yielded by keys. It returns when all keys have
+// been loaded, with the error of the iterator or ctx.Err() if ctx is done
+// first. Failed loads are reported in the returned WarmProgress, not as
+// an error.
+func (g *Group) WarmFrom(ctx context.Context, keys KeyIterator, opts *WarmOptions) (WarmProgress, error) {
+	var o WarmOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = defaultWarmConcurrency
+	}
+	limiter := newRateLimiter(o.Rate)
+
+	var (
+		mu       sync.Mutex
+		progress = WarmProgress{Total: o.Total}
+	)
+	report := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		progress.Done++
+		if err != nil {
+			progress.Failed++
+			progress.Err = err
+			g.logger.Debug("warm key failed", "group", g.name, "err", err)
+		}
+		if o.Progress != nil {
+			o.Progress(progress)
+		}
+	}
+
+	work := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < o.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range work {
+				_, err := g.GetContext(ctx, key)
+				report(err)
+			}
+		}()
+	}
+
+	var err error
+	for err == nil {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		key, ok := keys.Next()
+		if !ok {
+			err = keys.Err()
+			break
+		}
+		if err = limiter.wait(ctx); err != nil {
+			break
+		}
+		select {
+		case work <- key:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	g.logger.Info("warm finished", "group", g.name, "done", progress.Done, "failed", progress.Failed)
+	return progress, err
+}
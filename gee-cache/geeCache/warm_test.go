@@ -0,0 +1,105 @@
+package geeCache
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWarm(t *testing.T) {
+	var loads int32
+	gee := NewGroupOpts("warm", GetterFunc(
+		func(key string) ([]byte, error) {
+			atomic.AddInt32(&loads, 1)
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+		}), 2<<10, &GroupOptions{Logger: DiscardLogger})
+
+	p := gee.Warm([]string{"Tom", "Jack", "Sam", "unknown"}, 2)
+	if p.Done != 4 || p.Failed != 1 || p.Total != 4 {
+		t.Fatalf("unexpected progress %+v", p)
+	}
+	for k := range db {
+		if !gee.Cached(k) {
+			t.Fatalf("expect %s warmed", k)
+		}
+	}
+	if n := atomic.LoadInt32(&loads); n != 4 {
+		t.Fatalf("expect 4 loads, got %d", n)
+	}
+}
+
+func TestWarmFromOwner(t *testing.T) {
+	owner := &countingPeer{}
+	gee := NewGroupOpts("warm-owner", GetterFunc(
+		func(key string) ([]byte, error) {
+			t.Fatalf("unexpected local load of %s", key)
+			return nil, nil
+		}), 2<<10, &GroupOptions{Logger: DiscardLogger})
+	gee.RegisterPeers(fakePicker{owner})
+
+	var reports []WarmProgress
+	p, err := gee.WarmFrom(context.Background(), LineKeys(strings.NewReader("Tom\n\n Jack \nSam\n")), &WarmOptions{
+		Rate:     100,
+		Progress: func(p WarmProgress) { reports = append(reports, p) },
+	})
+	if err != nil || p.Done != 3 || p.Failed != 0 {
+		t.Fatalf("unexpected progress %+v %v", p, err)
+	}
+	// 远程的key由owner加载，本地不缓存
+	if n := atomic.LoadInt32(&owner.gets); n != 3 {
+		t.Fatalf("expect 3 requests to the owner, got %d", n)
+	}
+	if gee.Cached("Tom") {
+		t.Fatal("expect remote keys kept out of the local cache")
+	}
+	if len(reports) != 3 || reports[2].Done != 3 {
+		t.Fatalf("unexpected progress reports %+v", reports)
+	}
+}
+
+func TestWarmCanceled(t *testing.T) {
+	gee := NewGroupOpts("warm-cancel", GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), 2<<10, &GroupOptions{Logger: DiscardLogger})
+
+	keys := make([]string, 100)
+	for i := range keys {
+		keys[i] = fmt.Sprint(i)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	// 每秒20个key，100个key来不及在超时前加载完
+	p, err := gee.WarmFrom(ctx, SliceKeys(keys), &WarmOptions{Rate: 20})
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expect deadline exceeded, got %v", err)
+	}
+	if p.Done == 0 || p.Done >= len(keys) {
+		t.Fatalf("expect a partial warm-up, got %+v", p)
+	}
+}
+
+func TestWarmCanceledWhileLimited(t *testing.T) {
+	gee := NewGroupOpts("warm-cancel-limited", GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), 2<<10, &GroupOptions{Logger: DiscardLogger})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	// 每秒1个key，等待下一次放行时ctx就结束了，不应等满一秒
+	start := time.Now()
+	_, err := gee.WarmFrom(ctx, SliceKeys([]string{"a", "b", "c"}), &WarmOptions{Rate: 1})
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expect deadline exceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("expect the rate limiter to stop waiting on cancel, took %v", elapsed)
+	}
+}
@@ -0,0 +1,159 @@
+package geeCache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	pb "geeCache/geecachepb"
+	"sync"
+)
+
+// A Setter persists a value for a key to the origin.
+type Setter interface {
+	Set(key string, value []byte) error
+}
+
+// A SetterFunc implements Setter with a function.
+type SetterFunc func(key string, value []byte) error
+
+// Set implements Setter interface function
+func (f SetterFunc) Set(key string, value []byte) error {
+	return f(key, value)
+}
+
+// SetEntry is one write flushed to a BatchSetter.
+type SetEntry struct {
+	Key   string
+	Value []byte
+}
+
+// A BatchSetter is a Setter that can persist several values in one call.
+// Write-behind groups use it to flush their queue; entries of a batch
+// have distinct keys.
+type BatchSetter interface {
+	Setter
+	SetBatch(entries []SetEntry) error
+}
+
+// WriteMode selects when Group.Set persists a value to the origin.
+type WriteMode int
+
+const (
+	// WriteThrough persists the value before Set returns, then caches it.
+	WriteThrough WriteMode = iota
+	// WriteBehind caches the value and queues it; the queue is flushed
+	// to the origin in batches and retried on failure. Until a write is
+	// flushed, loads on the owner return the queued value instead of
+	// reading the origin.
+	WriteBehind
+)
+
+// ErrNoSetter is returned by Set on a group created without a Setter.
+var ErrNoSetter = errors.New("geecache: group has no Setter")
+
+// keyLocks 保证同一个key的写入串行执行。写入要等待数据源返回，每个key
+// 单独一把锁，不同的key不会因为共享锁而互相等待；没有写入时锁被回收
+type keyLocks struct {
+	mu    sync.Mutex
+	locks map[string]*keyLock
+}
+
+type keyLock struct {
+	sync.Mutex
+	refs int // 持有或等待这把锁的写入数
+}
+
+// lock 锁住key，返回的函数用于解锁
+func (l *keyLocks) lock(key string) (unlock func()) {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*keyLock)
+	}
+	kl, ok := l.locks[key]
+	if !ok {
+		kl = &keyLock{}
+		l.locks[key] = kl
+	}
+	kl.refs++
+	l.mu.Unlock()
+
+	kl.Lock()
+	return func() {
+		kl.Unlock()
+		l.mu.Lock()
+		if kl.refs--; kl.refs == 0 {
+			delete(l.locks, key)
+		}
+		l.mu.Unlock()
+	}
+}
+
+// Set writes value for key. The write is sent to the key's owner, which
+// persists it with the group's Setter according to its WriteMode and
+// updates its cache and replicas. Writes to the same key are applied in
+// the order the owner receives them.
+func (g *Group) Set(key string, value []byte) error {
+	return g.SetContext(context.Background(), key, value)
+}
+
+// SetContext is like Set, but cancelling ctx abandons the request to the owner.
+func (g *Group) SetContext(ctx context.Context, key string, value []byte) error {
+	g.Stats.Sets.Add(1)
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+	if g.setter == nil {
+		return ErrNoSetter
+	}
+	// 其他节点转发来的写入不再转发
+	var owners []PeerGetter
+	if !isForwarded(ctx) {
+		owners = g.owners(ctx, key)
+		if setter, ok := owners[0].(PeerSetter); ok {
+			err := setter.Set(ctx, &pb.Request{Group: g.name, Key: key}, value)
+			// 本地的热点副本已经过期
+			g.hotCache.remove(key)
+			if err != nil {
+				g.Stats.SetErrs.Add(1)
+			}
+			return err
+		}
+	}
+	if err := g.setLocally(key, cloneBytes(value)); err != nil {
+		g.Stats.SetErrs.Add(1)
+		return err
+	}
+	return nil
+}
+
+// setLocally 在owner上写入数据源并更新缓存
+func (g *Group) setLocally(key string, value []byte) error {
+	defer g.keyLocks.lock(key)()
+	if g.writer != nil {
+		// write-behind: 先入队再更新缓存，队列满时拒绝写入
+		if err := g.writer.enqueue(key, value); err != nil {
+			return err
+		}
+	} else if err := g.setter.Set(key, value); err != nil {
+		return err
+	}
+	// 进行中的加载可能读到了旧值，不再让它写入缓存；新的版本号让副本
+	// 丢弃写入之前开始加载的推送
+	g.generations.bump(key)
+	version := g.versions.next(key)
+	view := ByteView{b: value}
+	g.populateCache(key, view)
+	if g.peers != nil {
+		g.pushToReplicas(g.owners(context.Background(), key), key, view, version)
+	}
+	return nil
+}
+
+// Flush waits until the write-behind queue of the group is empty, or ctx
+// is done. It returns immediately for write-through groups.
+func (g *Group) Flush(ctx context.Context) error {
+	if g.writer == nil {
+		return nil
+	}
+	return g.writer.flush(ctx)
+}
@@ -0,0 +1,254 @@
+package geeCache
+
+import (
+	"context"
+	"fmt"
+	pb "geeCache/geecachepb"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memOrigin 是测试用的数据源，记录每次写入
+type memOrigin struct {
+	mu      sync.Mutex
+	data    map[string]string
+	batches int
+	fails   int           // 前fails次写入失败
+	block   chan struct{} // 非nil时写入前等待
+}
+
+func newMemOrigin() *memOrigin {
+	return &memOrigin{data: make(map[string]string)}
+}
+
+func (o *memOrigin) Get(key string) ([]byte, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if v, ok := o.data[key]; ok {
+		return []byte(v), nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+}
+
+func (o *memOrigin) Set(key string, value []byte) error {
+	return o.SetBatch([]SetEntry{{Key: key, Value: value}})
+}
+
+func (o *memOrigin) SetBatch(entries []SetEntry) error {
+	if o.block != nil {
+		<-o.block
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.batches++
+	if o.fails > 0 {
+		o.fails--
+		return fmt.Errorf("origin unavailable")
+	}
+	for _, e := range entries {
+		o.data[e.Key] = string(e.Value)
+	}
+	return nil
+}
+
+func (o *memOrigin) value(key string) string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.data[key]
+}
+
+func TestWriteThrough(t *testing.T) {
+	origin := newMemOrigin()
+	gee := NewGroupOpts("write-through", origin, 2<<10, &GroupOptions{Setter: origin})
+	if err := gee.Set("Tom", []byte("631")); err != nil {
+		t.Fatal(err)
+	}
+	if origin.value("Tom") != "631" || !gee.Cached("Tom") {
+		t.Fatal("expect the write persisted and cached")
+	}
+
+	origin.fails = 1
+	if err := gee.Set("Tom", []byte("632")); err == nil {
+		t.Fatal("expect the origin error")
+	}
+	if v, _ := gee.Get("Tom"); v.String() != "631" {
+		t.Fatalf("expect a failed write not to reach the cache, got %s", v)
+	}
+
+	readOnly := NewGroup("read-only", origin, 2<<10)
+	if err := readOnly.Set("Tom", nil); err != ErrNoSetter {
+		t.Fatalf("expect ErrNoSetter, got %v", err)
+	}
+}
+
+func TestWriteBehind(t *testing.T) {
+	origin := newMemOrigin()
+	origin.block = make(chan struct{})
+	origin.fails = 1
+	gee := NewGroupOpts("write-behind", origin, 2<<10, &GroupOptions{
+		Setter:     origin,
+		WriteMode:  WriteBehind,
+		WriteDelay: time.Millisecond,
+		Logger:     DiscardLogger,
+	})
+	defer gee.Close()
+
+	// 第一批被阻塞在数据源上，之后的写入在队列中合并
+	gee.Set("Tom", []byte("1"))
+	for gee.Stats.WriteQueue.Get() != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	for i := 2; i <= 5; i++ {
+		gee.Set("Tom", []byte(fmt.Sprint(i)))
+	}
+	gee.Set("Jack", []byte("590"))
+	if n := gee.Stats.WriteQueue.Get(); n != 2 {
+		t.Fatalf("expect 2 keys queued, got %d", n)
+	}
+	if v, _ := gee.Get("Tom"); v.String() != "5" {
+		t.Fatalf("expect the owner cache updated at once, got %s", v)
+	}
+
+	close(origin.block)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := gee.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if origin.value("Tom") != "5" || origin.value("Jack") != "590" {
+		t.Fatalf("expect the latest values persisted, got %v", origin.data)
+	}
+	// 第一批失败重试一次，之后的两个key合并为一批
+	if r := gee.Stats.WriteRetries.Get(); r != 1 {
+		t.Fatalf("expect 1 retry, got %d", r)
+	}
+	if origin.batches != 3 || gee.Stats.WritesFlushed.Get() != 3 {
+		t.Fatalf("expect 3 batches and 3 writes, got %d and %d", origin.batches, gee.Stats.WritesFlushed.Get())
+	}
+}
+
+func TestWriteBehindReadBeforeFlush(t *testing.T) {
+	origin := newMemOrigin()
+	origin.data["Tom"], origin.data["Jack"] = "630", "589"
+	origin.block = make(chan struct{})
+	gee := NewGroupOpts("write-behind-read", origin, 2<<10, &GroupOptions{
+		Setter:     origin,
+		WriteMode:  WriteBehind,
+		WriteDelay: time.Millisecond,
+		Logger:     DiscardLogger,
+	})
+	defer gee.Close()
+
+	// Tom正在写入，Jack还在队列中，两者都被淘汰出缓存
+	gee.Set("Tom", []byte("631"))
+	for gee.Stats.WriteQueue.Get() != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	gee.Set("Jack", []byte("590"))
+	gee.mainCache.remove("Tom")
+	gee.mainCache.remove("Jack")
+
+	for key, want := range map[string]string{"Tom": "631", "Jack": "590"} {
+		if v, err := gee.Get(key); err != nil || v.String() != want {
+			t.Fatalf("expect the queued value %s of %s, got %v %v", want, key, v, err)
+		}
+	}
+	if n := gee.Stats.LocalLoads.Get(); n != 0 {
+		t.Fatalf("expect the origin not read before the flush, got %d loads", n)
+	}
+
+	close(origin.block)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := gee.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if origin.value("Tom") != "631" || origin.value("Jack") != "590" {
+		t.Fatalf("expect the queued values persisted, got %v", origin.data)
+	}
+}
+
+type setterPeer struct {
+	fakePeer
+	sets map[string]string
+}
+
+func (p *setterPeer) Set(ctx context.Context, in *pb.Request, value []byte) error {
+	p.sets[in.GetKey()] = string(value)
+	return nil
+}
+
+func TestSetForwardsToOwner(t *testing.T) {
+	origin := newMemOrigin()
+	owner := &setterPeer{sets: make(map[string]string)}
+	gee := NewGroupOpts("set-forward", origin, 2<<10, &GroupOptions{Setter: origin})
+	gee.RegisterPeers(fakePicker{owner})
+	if err := gee.Set("Tom", []byte("631")); err != nil {
+		t.Fatal(err)
+	}
+	if owner.sets["Tom"] != "631" || origin.value("Tom") != "" {
+		t.Fatal("expect the write sent to the owner only")
+	}
+
+	// 经过HTTP转发的写入在owner上直接写入数据源，只接受签名过的、
+	// 发给owner的请求
+	remote := newMemOrigin()
+	NewGroupOpts("set-remote", remote, 2<<10, &GroupOptions{Setter: remote})
+	self := "http://self"
+	set := func(opts *HTTPPoolOptions, owner, value string) error {
+		pool := NewHTTPPoolOpts(self, opts)
+		pool.Set(owner)
+		srv := httptest.NewServer(pool)
+		defer srv.Close()
+		getter := &httpGetter{baseURL: srv.URL + defaultBasePath, client: http.DefaultClient, secret: opts.Secret}
+		return getter.Set(context.Background(), &pb.Request{Group: "set-remote", Key: "Tom"}, []byte(value))
+	}
+	if err := set(&HTTPPoolOptions{Logger: DiscardLogger}, self, "630"); err == nil || remote.value("Tom") != "" {
+		t.Fatal("expect an unsigned write rejected")
+	}
+	signed := &HTTPPoolOptions{Secret: testSecret, Logger: DiscardLogger}
+	if err := set(signed, "http://other", "631"); err == nil || remote.value("Tom") != "" {
+		t.Fatal("expect a write for a key this node does not own rejected")
+	}
+	if err := set(signed, self, "632"); err != nil {
+		t.Fatal(err)
+	}
+	if remote.value("Tom") != "632" {
+		t.Fatal("expect the owner to persist the write")
+	}
+}
+
+func TestKeyLocks(t *testing.T) {
+	var l keyLocks
+	unlockA := l.lock("a")
+	// 其他key的写入不需要等待
+	done := make(chan struct{})
+	go func() {
+		l.lock("b")()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("a write to b waited for a")
+	}
+
+	locked := make(chan struct{})
+	go func() {
+		l.lock("a")()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+		t.Fatal("expect the second write to a to wait")
+	case <-time.After(20 * time.Millisecond):
+	}
+	unlockA()
+	<-locked
+	if len(l.locks) != 0 {
+		t.Fatalf("expect unused locks released, got %d", len(l.locks))
+	}
+}
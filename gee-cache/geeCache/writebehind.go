@@ -0,0 +1,236 @@
+package geeCache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	defaultWriteBatch   = 100
+	defaultWriteDelay   = 100 * time.Millisecond
+	defaultWriteRetries = 3
+	defaultWriteQueue   = 10000
+	// 重试之间的初始等待时间，每次翻倍
+	writeRetryBackoff = 50 * time.Millisecond
+)
+
+// writeBehind 把写入排队，由一个goroutine按批写入数据源。
+// 同一个key在队列中只保留最新的值，且同一时间只有一批在写入，
+// 因此同一个key的写入顺序与入队顺序一致。
+type writeBehind struct {
+	setter  Setter
+	batch   int
+	delay   time.Duration
+	retries int
+	max     int
+	group   *Group
+
+	mu       sync.Mutex
+	pending  map[string][]byte // 等待写入的最新值
+	order    []string          // pending中的key，按第一次入队的顺序
+	writing  map[string][]byte // 正在写入的一批条目
+	inflight int               // 正在写入的条目数
+	kick     chan struct{}
+	done     chan struct{}
+	stopped  chan struct{}
+	stop     sync.Once
+}
+
+func newWriteBehind(g *Group, setter Setter, o *GroupOptions) *writeBehind {
+	w := &writeBehind{
+		setter:  setter,
+		batch:   o.WriteBatchSize,
+		delay:   o.WriteDelay,
+		retries: o.WriteRetries,
+		max:     o.MaxWriteQueue,
+		group:   g,
+		pending: make(map[string][]byte),
+		kick:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	if w.batch <= 0 {
+		w.batch = defaultWriteBatch
+	}
+	if w.delay <= 0 {
+		w.delay = defaultWriteDelay
+	}
+	if w.retries <= 0 {
+		w.retries = defaultWriteRetries
+	}
+	if w.max <= 0 {
+		w.max = defaultWriteQueue
+	}
+	go w.run()
+	return w
+}
+
+// enqueue 把写入加入队列，队列已满时返回 ErrOverloaded
+func (w *writeBehind) enqueue(key string, value []byte) error {
+	w.mu.Lock()
+	if _, ok := w.pending[key]; !ok {
+		if len(w.order) >= w.max {
+			w.mu.Unlock()
+			return ErrOverloaded
+		}
+		w.order = append(w.order, key)
+	}
+	w.pending[key] = value
+	w.setDepth()
+	w.mu.Unlock()
+	select {
+	case w.kick <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// lookup 返回key还没写入数据源的最新值，包括正在写入的值
+func (w *writeBehind) lookup(key string) ([]byte, bool) {
+	if w == nil {
+		return nil, false
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if value, ok := w.pending[key]; ok {
+		return value, true
+	}
+	value, ok := w.writing[key]
+	return value, ok
+}
+
+// setDepth 更新队列长度的统计，调用时需持有锁
+func (w *writeBehind) setDepth() {
+	s := &w.group.Stats.WriteQueue
+	s.Add(int64(len(w.order)) - s.Get())
+}
+
+func (w *writeBehind) run() {
+	defer close(w.stopped)
+	for {
+		select {
+		case <-w.kick:
+		case <-w.done:
+			w.drain()
+			return
+		}
+		// 等待一小段时间，让更多的写入合并到同一批中
+		timer := time.NewTimer(w.delay)
+		select {
+		case <-timer.C:
+		case <-w.done:
+			timer.Stop()
+		}
+		w.drain()
+	}
+}
+
+// drain 按批写入队列中的所有条目
+func (w *writeBehind) drain() {
+	for {
+		w.mu.Lock()
+		n := len(w.order)
+		if n > w.batch {
+			n = w.batch
+		}
+		entries := make([]SetEntry, n)
+		for i, key := range w.order[:n] {
+			entries[i] = SetEntry{Key: key, Value: w.pending[key]}
+			delete(w.pending, key)
+		}
+		w.order = w.order[n:]
+		w.writing = make(map[string][]byte, n)
+		for _, e := range entries {
+			w.writing[e.Key] = e.Value
+		}
+		w.inflight = n
+		w.setDepth()
+		w.mu.Unlock()
+		if n == 0 {
+			return
+		}
+		w.write(entries)
+		w.mu.Lock()
+		w.writing, w.inflight = nil, 0
+		w.mu.Unlock()
+	}
+}
+
+// write 写入一批条目，失败时按指数退避重试，重试用尽后丢弃
+func (w *writeBehind) write(entries []SetEntry) {
+	g := w.group
+	backoff := writeRetryBackoff
+	for attempt := 0; ; attempt++ {
+		failed := w.set(entries)
+		if len(failed) == 0 {
+			g.Stats.WritesFlushed.Add(int64(len(entries)))
+			return
+		}
+		g.Stats.WritesFlushed.Add(int64(len(entries) - len(failed)))
+		entries = failed
+		if attempt >= w.retries {
+			break
+		}
+		g.Stats.WriteRetries.Add(1)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-w.done:
+			timer.Stop()
+		}
+		backoff *= 2
+	}
+	g.Stats.WritesDropped.Add(int64(len(entries)))
+	for _, e := range entries {
+		g.logger.Error("dropped write-behind entry", "group", g.name, "key", e.Key)
+	}
+}
+
+// set 写入一批条目，返回失败的条目
+func (w *writeBehind) set(entries []SetEntry) []SetEntry {
+	if bs, ok := w.setter.(BatchSetter); ok {
+		if err := bs.SetBatch(entries); err != nil {
+			w.group.logger.Warn("write-behind batch failed", "group", w.group.name, "entries", len(entries), "err", err)
+			return entries
+		}
+		return nil
+	}
+	var failed []SetEntry
+	for _, e := range entries {
+		if err := w.setter.Set(e.Key, e.Value); err != nil {
+			w.group.logger.Warn("write-behind failed", "group", w.group.name, "key", e.Key, "err", err)
+			failed = append(failed, e)
+		}
+	}
+	return failed
+}
+
+// flush 等待队列清空
+func (w *writeBehind) flush(ctx context.Context) error {
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		w.mu.Lock()
+		idle := len(w.order) == 0 && w.inflight == 0
+		w.mu.Unlock()
+		if idle {
+			return nil
+		}
+		select {
+		case w.kick <- struct{}{}:
+		default:
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// close 写入剩余的条目后停止
+func (w *writeBehind) close() {
+	w.stop.Do(func() { close(w.done) })
+	<-w.stopped
+}
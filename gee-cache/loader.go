@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"geeCache"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// newGetter 根据配置创建缓存未命中时调用的 Getter，返回值同时实现了 geeCache.Setter
+func newGetter(cfg LoaderConfig, logger geeCache.Logger) (geeCache.Getter, error) {
+	switch cfg.Type {
+	case "static":
+		return newMemStore(cfg.Data, logger), nil
+	case "file":
+		b, err := ioutil.ReadFile(cfg.Path)
+		if err != nil {
+			return nil, err
+		}
+		data := make(map[string]string)
+		if err := json.Unmarshal(b, &data); err != nil {
+			return nil, fmt.Errorf("parsing %s: %v", cfg.Path, err)
+		}
+		return newMemStore(data, logger), nil
+	case "http":
+		return httpLoader(cfg.URL), nil
+	}
+	return nil, fmt.Errorf("unknown loader type %q", cfg.Type)
+}
+
+// memStore 是内存中的数据源，写入不会保存回文件
+type memStore struct {
+	mu     sync.RWMutex
+	db     map[string]string
+	logger geeCache.Logger
+}
+
+func newMemStore(db map[string]string, logger geeCache.Logger) *memStore {
+	return &memStore{db: db, logger: logger}
+}
+
+func (s *memStore) Get(key string) ([]byte, error) {
+	s.logger.Debug("searching source", "key", key)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if v, ok := s.db[key]; ok {
+		return []byte(v), nil
+	}
+	return nil, fmt.Errorf("%w: %s", geeCache.ErrNotFound, key)
+}
+
+func (s *memStore) Set(key string, value []byte) error {
+	s.logger.Debug("writing source", "key", key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.db[key] = string(value)
+	return nil
+}
+
+// httpLoader 把 {key} 替换为转义后的key，从源服务获取数据，写入时使用PUT
+type httpLoader string
+
+func (l httpLoader) url(key string) string {
+	return strings.Replace(string(l), "{key}", url.PathEscape(key), -1)
+}
+
+func (l httpLoader) Get(key string) ([]byte, error) {
+	res, err := http.Get(l.url(key))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", geeCache.ErrNotFound, key)
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("origin returned: %v", res.Status)
+	}
+	return ioutil.ReadAll(res.Body)
+}
+
+func (l httpLoader) Set(key string, value []byte) error {
+	req, err := http.NewRequest(http.MethodPut, l.url(key), bytes.NewReader(value))
+	if err != nil {
+		return err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("origin returned: %v", res.Status)
+	}
+	return nil
+}
@@ -1,83 +1,288 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"geeCache"
+	"io/ioutil"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 )
 
-var db = map[string]string{
-	"Tom":  "630",
-	"Jack": "589",
-	"Sam":  "567",
-}
-
-func createGroup() *geeCache.Group {
-	return geeCache.NewGroup("scores", geeCache.GetterFunc(
-		func(key string) ([]byte, error) {
-			log.Println("[SlowDB] search key", key)
-			if v, ok := db[key]; ok {
-				return []byte(v), nil
-			}
-			return nil, fmt.Errorf("%s not exist", key)
-		}), 2<<10)
+// 启动缓存服务器，直到 peers.Shutdown 被调用
+func startCacheServer(cfg *Config, peers *geeCache.HTTPPool, logger geeCache.Logger) {
+	mux := http.NewServeMux()
+	mux.Handle(cfg.BasePath, peers)
+	if cfg.AdminPath != "" {
+		admin := geeCache.NewAdminHandler(cfg.AdminPath, peers)
+		admin.Token = cfg.AdminToken
+		mux.Handle(cfg.AdminPath, admin)
+	}
+	// 启动HTTP服务
+	logger.Info("geecache is running", "self", cfg.Self, "listen", cfg.Listen)
+	if err := peers.ListenAndServe(cfg.Listen, mux); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
 }
 
-// 启动缓存服务器
-func startCacheServer(addr string, addrs []string, gee *geeCache.Group) {
-	// 创建HTTPPool
-	peers := geeCache.NewHTTPPool(addr)
-	// 添加节点信息
-	peers.Set(addrs...)
-	// 注册到gee中
-	gee.RegisterPeers(peers)
-	// 启动HTTP服务
-	log.Println("geecache is running at", addr)
-	log.Fatal(http.ListenAndServe(addr[7:], peers))
+// warm 按配置的key列表预热各个group，失败的key只记录日志，ctx结束时停止预热
+func warm(ctx context.Context, cfg *Config, logger geeCache.Logger) {
+	for _, g := range cfg.Groups {
+		if g.WarmFile == "" {
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		start := time.Now()
+		p, err := geeCache.GetGroup(g.Name).WarmFile(ctx, g.WarmFile, &geeCache.WarmOptions{
+			Concurrency: g.WarmConcurrency,
+			Rate:        g.WarmRate,
+			Progress: func(p geeCache.WarmProgress) {
+				if p.Done%1000 == 0 {
+					logger.Info("warming", "group", g.Name, "done", p.Done, "failed", p.Failed)
+				}
+			},
+		})
+		if err != nil {
+			logger.Error("warm failed", "group", g.Name, "err", err)
+			continue
+		}
+		logger.Info("warmed", "group", g.Name, "done", p.Done, "failed", p.Failed, "took", time.Since(start))
+	}
 }
 
-// 启动API服务（9999）
-func startAPIServer(apiAddr string, gee *geeCache.Group) {
-	http.Handle("/api", http.HandlerFunc(
+// 启动API服务，直到返回的 server 被关闭
+func startAPIServer(apiAddr string, defaultGroup string, logger geeCache.Logger) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/api", http.HandlerFunc(
 		func(w http.ResponseWriter, r *http.Request) {
+			name := r.URL.Query().Get("group")
+			if name == "" {
+				name = defaultGroup
+			}
+			gee := geeCache.GetGroup(name)
+			if gee == nil {
+				http.Error(w, "no such group: "+name, http.StatusNotFound)
+				return
+			}
 			key := r.URL.Query().Get("key")
-			view, err := gee.Get(key)
+			if r.Method == http.MethodPut {
+				setValue(w, r, gee, key)
+				return
+			}
+			view, err := gee.GetContext(r.Context(), key)
+			if errors.Is(err, geeCache.ErrNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			if errors.Is(err, geeCache.ErrOverloaded) {
+				w.Header().Set("Retry-After", "1")
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+				return
+			}
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
 			w.Header().Set("Content-Type", "application/octet-stream")
-			w.Write(view.ByteSlice())
+			view.WriteTo(w)
 		}))
-	log.Println("fontend server is running at", apiAddr)
-	log.Fatal(http.ListenAndServe(apiAddr[7:], nil))
+	server := &http.Server{Addr: apiAddr, Handler: mux}
+	go func() {
+		logger.Info("api server is running", "listen", apiAddr)
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+	return server
+}
+
+// setValue 处理 PUT /api?group=&key= 请求，请求体为新的值
+func setValue(w http.ResponseWriter, r *http.Request, gee *geeCache.Group, key string) {
+	value, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = gee.SetContext(r.Context(), key, value)
+	switch {
+	case errors.Is(err, geeCache.ErrNoSetter):
+		http.Error(w, err.Error(), http.StatusMethodNotAllowed)
+	case errors.Is(err, geeCache.ErrOverloaded):
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// notifyShutdown 返回收到 SIGINT 或 SIGTERM 时结束的ctx
+func notifyShutdown(logger geeCache.Logger) context.Context {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		logger.Info("shutting down", "signal", <-sig)
+		cancel()
+	}()
+	return ctx
+}
 
+// waitForShutdown 在stop结束后先关闭API服务，再关闭缓存服务
+func waitForShutdown(stop context.Context, timeout time.Duration, api *http.Server, peers *geeCache.HTTPPool, logger geeCache.Logger) {
+	<-stop.Done()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if api != nil {
+		if err := api.Shutdown(ctx); err != nil {
+			logger.Error("api server shutdown", "err", err)
+		}
+	}
+	if err := peers.Shutdown(ctx); err != nil {
+		logger.Error("cache server shutdown", "err", err)
+	}
+}
+
+// newPool 根据配置创建HTTPPool
+func newPool(cfg *Config, logger geeCache.Logger) (*geeCache.HTTPPool, error) {
+	opts := &geeCache.HTTPPoolOptions{
+		BasePath:    cfg.BasePath,
+		Replicas:    cfg.Replicas,
+		Replication: cfg.Replication,
+
+		HandoffOnShutdown: cfg.HandoffOnShutdown,
+		Logger:            logger,
+	}
+	if cfg.Secret != "" {
+		opts.Secret = []byte(cfg.Secret)
+	}
+	if cfg.TLS != nil {
+		tlsConfig, err := geeCache.NewMutualTLSConfig(cfg.TLS.Cert, cfg.TLS.Key, cfg.TLS.CA)
+		if err != nil {
+			return nil, fmt.Errorf("tls: %v", err)
+		}
+		opts.TLSConfig = tlsConfig
+	}
+	peers := geeCache.NewHTTPPoolOpts(cfg.Self, opts)
+	if len(cfg.Peers) > 0 {
+		peers.Set(cfg.Peers...)
+	} else {
+		// 没有配置节点列表时以单节点模式运行
+		peers.Set(cfg.Self)
+	}
+	return peers, nil
 }
 
 func main() {
-	var port int
-	var api bool
-	flag.IntVar(&port, "port", 8001, "Geecache server port")
-	flag.BoolVar(&api, "api", false, "Start a api server?")
+	var (
+		configPath  = flag.String("config", "", "path to a JSON config file")
+		self        = flag.String("self", "", "address of this node as listed in peers, e.g. http://localhost:8001")
+		listen      = flag.String("listen", "", "listen address of the cache server (default: host:port of -self)")
+		api         = flag.String("api", "", "listen address of the API server, e.g. localhost:9999")
+		peerList    = flag.String("peers", "", "comma separated peer addresses")
+		replication = flag.Int("replication", 0, "number of peers holding each key")
+		secret      = flag.String("secret", "", "shared secret used to sign peer requests")
+		logLevel    = flag.String("log-level", "", "debug, info, warn or error (default warn)")
+	)
 	flag.Parse()
 
-	apiAddr := "http://localhost:9999"
-	addrMap := map[int]string{
-		8001: "http://localhost:8001",
-		8002: "http://localhost:8002",
-		8003: "http://localhost:8003",
+	cfg := &Config{}
+	if *configPath != "" {
+		var err error
+		if cfg, err = loadConfig(*configPath); err != nil {
+			fmt.Fprintln(os.Stderr, "geecache:", err)
+			os.Exit(2)
+		}
+	}
+	// 命令行参数覆盖配置文件
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "self":
+			cfg.Self = *self
+		case "listen":
+			cfg.Listen = *listen
+		case "api":
+			cfg.APIListen = *api
+		case "peers":
+			cfg.Peers = strings.Split(*peerList, ",")
+		case "replication":
+			cfg.Replication = *replication
+		case "secret":
+			cfg.Secret = *secret
+		case "log-level":
+			cfg.LogLevel = *logLevel
+		}
+	})
+	if err := cfg.validate(); err != nil {
+		fmt.Fprintln(os.Stderr, "geecache:", err)
+		os.Exit(2)
 	}
 
-	var addrs []string
-	for _, v := range addrMap {
-		addrs = append(addrs, v)
+	level, _ := cfg.level()
+	logger := geeCache.NewLogger(level)
+	peers, err := newPool(cfg, logger)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var budget *geeCache.Budget
+	if cfg.MemoryBytes > 0 {
+		budget = geeCache.NewBudget(cfg.MemoryBytes)
+	}
+	for _, g := range cfg.Groups {
+		getter, err := newGetter(g.Loader, logger)
+		if err != nil {
+			log.Fatalf("group %s: %v", g.Name, err)
+		}
+		eviction, _ := g.eviction()
+		opts := &geeCache.GroupOptions{
+			Budget:             budget,
+			MaxEntries:         g.MaxEntries,
+			Eviction:           eviction,
+			Priority:           g.Priority,
+			MaxConcurrentLoads: g.MaxConcurrentLoads,
+			MaxLoadQueue:       g.MaxLoadQueue,
+			LoadQueueTimeout:   g.LoadQueueTimeout.Duration,
+			HedgeDelay:         g.HedgeDelay.Duration,
+			HotKeyThreshold:    g.HotKeyThreshold,
+			HotCacheTTL:        g.HotCacheTTL.Duration,
+			Logger:             logger,
+		}
+		if g.WriteMode != "" {
+			// 内置的loader都可以写入
+			opts.Setter = getter.(geeCache.Setter)
+			if g.WriteMode == "behind" {
+				opts.WriteMode = geeCache.WriteBehind
+			}
+		}
+		// 注册到gee中
+		geeCache.NewGroupOpts(g.Name, getter, g.CacheBytes, opts).RegisterPeers(peers)
 	}
 
-	gee := createGroup()
-	if api {
-		go startAPIServer(apiAddr, gee)
+	// 预热期间收到信号也要能退出，所以在预热之前监听信号
+	stop := notifyShutdown(logger)
+	done := make(chan struct{})
+	go func() {
+		startCacheServer(cfg, peers, logger)
+		close(done)
+	}()
+	// 预热完成后才开始对外提供服务
+	warm(stop, cfg, logger)
+	var apiServer *http.Server
+	if cfg.APIListen != "" && stop.Err() == nil {
+		apiServer = startAPIServer(cfg.APIListen, cfg.Groups[0].Name, logger)
 	}
-	startCacheServer(addrMap[port], addrs, gee)
+	waitForShutdown(stop, cfg.ShutdownTimeout.Duration, apiServer, peers, logger)
+	<-done
+	logger.Info("geecache stopped")
 }